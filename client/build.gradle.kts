@@ -21,6 +21,10 @@ dependencies {
     implementation("org.jetbrains.kotlinx:kotlinx-coroutines-core:1.10.2")
     implementation("io.grpc:grpc-protobuf:1.71.0")
 
+    // Propagates trace context to the trove-server, a no-op unless the host installs the OpenTelemetry SDK
+    implementation("io.opentelemetry:opentelemetry-api:1.49.0")
+    implementation("io.opentelemetry.instrumentation:opentelemetry-grpc-1.6:2.15.0-alpha")
+
     // For logging, config, etc.
     implementation("org.jetbrains.kotlin:kotlin-stdlib")
 
@@ -4,11 +4,19 @@ package com.runicrealms.trove.client
  * @param host The remote host of the gRPC server
  * @param port The port on which to connect to the gRPC server
  * @param clientName The unique identifier of this client among all database clients
+ * @param caFile PEM file of the CA that signed the server's certificate; when set, the connection uses TLS
+ * @param certFile PEM client certificate presented for mTLS, together with keyFile
+ * @param keyFile PEM private key of certFile
+ * @param token Bearer token authenticating this client, as an alternative to a client certificate
  *
  * clientName should correspond to the resource name of the service pod running the Trove Client.
  */
 data class TroveClientConfig(
     val host: String = "trove-server", // Uses coredns service resolution within the same namespace
     val port: Int = 9090,
-    val clientName: String
-)
\ No newline at end of file
+    val clientName: String,
+    val caFile: String? = null,
+    val certFile: String? = null,
+    val keyFile: String? = null,
+    val token: String? = null
+)
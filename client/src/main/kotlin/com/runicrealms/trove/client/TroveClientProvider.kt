@@ -2,16 +2,43 @@ package com.runicrealms.trove.client
 
 import com.google.inject.Inject
 import com.google.inject.Provider
-import io.grpc.ManagedChannelBuilder
+import io.grpc.Metadata
+import io.grpc.netty.GrpcSslContexts
+import io.grpc.netty.NettyChannelBuilder
+import io.grpc.stub.MetadataUtils
+import io.opentelemetry.api.GlobalOpenTelemetry
+import io.opentelemetry.instrumentation.grpc.v1_6.GrpcTelemetry
+import java.io.File
 
 class TroveClientProvider @Inject constructor(private val config: TroveClientConfig): Provider<TroveClient> {
 
     override fun get(): TroveClient {
-        val channel = ManagedChannelBuilder
-            .forAddress(config.host, config.port)
-            .usePlaintext()
+        val builder = NettyChannelBuilder.forAddress(config.host, config.port)
+        if (config.caFile != null) {
+            val ssl = GrpcSslContexts.forClient().trustManager(File(config.caFile))
+            if (config.certFile != null && config.keyFile != null) {
+                ssl.keyManager(File(config.certFile), File(config.keyFile))
+            }
+            builder.sslContext(ssl.build())
+        } else {
+            builder.usePlaintext()
+        }
+        val headers = Metadata()
+        // Failures arrive as status errors, which stubs throw and troveCall maps to a TroveException
+        headers.put(STATUS_ERRORS, "true")
+        if (config.token != null) {
+            headers.put(AUTHORIZATION, "Bearer ${config.token}")
+        }
+        builder.intercept(MetadataUtils.newAttachHeadersInterceptor(headers))
+        val channel = builder
+            .intercept(GrpcTelemetry.create(GlobalOpenTelemetry.get()).newClientInterceptor())
             .build()
         return TroveClient(channel, config.clientName)
     }
 
-}
\ No newline at end of file
+    private companion object {
+        val AUTHORIZATION: Metadata.Key<String> = Metadata.Key.of("authorization", Metadata.ASCII_STRING_MARSHALLER)
+        val STATUS_ERRORS: Metadata.Key<String> = Metadata.Key.of("trove-status-errors", Metadata.ASCII_STRING_MARSHALLER)
+    }
+
+}
@@ -0,0 +1,98 @@
+package com.runicrealms.trove.client
+
+import com.google.rpc.ErrorInfo
+import com.google.rpc.RetryInfo
+import io.grpc.Status
+import io.grpc.StatusException
+import io.grpc.protobuf.StatusProto
+
+/**
+ * A failed call to the trove-server, typed by its gRPC status code.
+ * The client opts in to status errors, so every failure reaches it as one of these through a failed [Result].
+ *
+ * @param code The gRPC status code the server failed with
+ * @param reason The ErrorInfo reason the server attached, such as LOCK_HELD, if any
+ */
+sealed class TroveException(
+    val code: Status.Code,
+    val reason: String?,
+    message: String?,
+    cause: Throwable
+) : Exception(message, cause) {
+
+    /** The request was malformed, such as an unknown table or column, and should not be retried as it is */
+    class InvalidRequest internal constructor(reason: String?, message: String?, cause: Throwable) :
+        TroveException(Status.Code.INVALID_ARGUMENT, reason, message, cause)
+
+    /** The player's lock is not held by this client, or its lease has expired */
+    class LockNotHeld internal constructor(reason: String?, message: String?, cause: Throwable) :
+        TroveException(Status.Code.FAILED_PRECONDITION, reason, message, cause)
+
+    /** Another server holds the player's lock */
+    class LockHeld internal constructor(reason: String?, message: String?, cause: Throwable) :
+        TroveException(Status.Code.ABORTED, reason, message, cause)
+
+    /** The row or entry asked for does not exist */
+    class NotFound internal constructor(reason: String?, message: String?, cause: Throwable) :
+        TroveException(Status.Code.NOT_FOUND, reason, message, cause)
+
+    /**
+     * The client went over its rate limit, or sent a request larger than the server allows
+     * @param retryAfterMillis How long the server asks to wait before trying again, if it said
+     */
+    class RateLimited internal constructor(
+        reason: String?,
+        message: String?,
+        cause: Throwable,
+        val retryAfterMillis: Long?
+    ) : TroveException(Status.Code.RESOURCE_EXHAUSTED, reason, message, cause)
+
+    /**
+     * The server or its database could not be reached, and the call can be retried
+     * @param retryAfterMillis How long the server asks to wait before trying again, if it said
+     */
+    class Unavailable internal constructor(
+        code: Status.Code,
+        reason: String?,
+        message: String?,
+        cause: Throwable,
+        val retryAfterMillis: Long?
+    ) : TroveException(code, reason, message, cause)
+
+    /** Any other failure, such as an internal server error */
+    class Failed internal constructor(code: Status.Code, reason: String?, message: String?, cause: Throwable) :
+        TroveException(code, reason, message, cause)
+
+    companion object {
+        /** Maps a status error thrown by a stub to its typed exception */
+        internal fun from(e: StatusException): TroveException {
+            val details = StatusProto.fromThrowable(e)?.detailsList.orEmpty()
+            val reason = details.firstOrNull { it.`is`(ErrorInfo::class.java) }
+                ?.unpack(ErrorInfo::class.java)?.reason
+            val retryAfterMillis = details.firstOrNull { it.`is`(RetryInfo::class.java) }
+                ?.unpack(RetryInfo::class.java)?.retryDelay
+                ?.let { it.seconds * 1000 + it.nanos / 1_000_000 }
+            val message = e.status.description
+            return when (val code = e.status.code) {
+                Status.Code.INVALID_ARGUMENT -> InvalidRequest(reason, message, e)
+                Status.Code.FAILED_PRECONDITION -> LockNotHeld(reason, message, e)
+                Status.Code.ABORTED -> LockHeld(reason, message, e)
+                Status.Code.NOT_FOUND -> NotFound(reason, message, e)
+                Status.Code.RESOURCE_EXHAUSTED -> RateLimited(reason, message, e, retryAfterMillis)
+                Status.Code.UNAVAILABLE, Status.Code.DEADLINE_EXCEEDED ->
+                    Unavailable(code, reason, message, e, retryAfterMillis)
+                else -> Failed(code, reason, message, e)
+            }
+        }
+    }
+
+}
+
+/** Runs a stub call, returning its failure as a [TroveException] */
+internal suspend fun <T> troveCall(call: suspend () -> T): Result<T> {
+    return try {
+        Result.success(call())
+    } catch (e: StatusException) {
+        Result.failure(TroveException.from(e))
+    }
+}
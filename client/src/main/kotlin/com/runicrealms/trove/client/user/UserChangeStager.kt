@@ -1,10 +1,12 @@
 package com.runicrealms.trove.client.user
 
+import com.runicrealms.trove.client.troveCall
 import com.runicrealms.trove.generated.api.trove.LockInfo
 import com.runicrealms.trove.generated.api.trove.SaveRequest
 import com.runicrealms.trove.generated.api.trove.TroveServiceGrpcKt
 import kotlinx.coroutines.sync.Mutex
 import kotlinx.coroutines.sync.withLock
+import java.util.UUID
 
 abstract class UserChangeStager(
     private val stub: TroveServiceGrpcKt.TroveServiceCoroutineStub,
@@ -16,31 +18,52 @@ abstract class UserChangeStager(
 
     private val stageMutex = Mutex()
 
+    // Key of the staged change set, kept until it saves so that retries of it reuse the same key
+    private var idempotencyKey: String? = null
+
     suspend fun save(): Result<Unit> {
         stageMutex.withLock {
-            val request = SaveRequest.newBuilder()
-                .setTable(table)
-                .setLock(lock)
-                .putAllSuperKeys(superKeys)
+            // A change set that failed to save is resent as it was first, in case it landed and only the response was lost
+            if (idempotencyKey != null) {
+                val result = saveStaged()
+                if (result.isFailure) return result
+            }
             for (column in columns) {
                 val data = column.pendingChanges
-                if (data != null) {
+                if (data != null && !column.quarantined) {
                     column.stagedChanges = data
-                    request.putColumnData(column.column, data)
+                    column.pendingChanges = null
                 }
             }
-            if (request.columnDataCount > 0) {
-                val response = stub.save(request.build())
-                if (!response.success) {
-                    return Result.failure(IllegalStateException(response.errorMessage))
-                }
+            idempotencyKey = UUID.randomUUID().toString()
+            return saveStaged()
+        }
+    }
+
+    private suspend fun saveStaged(): Result<Unit> {
+        val request = SaveRequest.newBuilder()
+            .setTable(table)
+            .setLock(lock)
+            .putAllSuperKeys(superKeys)
+            // Lets the server replay its response if this change set is retried after it already landed
+            .setIdempotencyKey(idempotencyKey)
+        for (column in columns) {
+            val data = column.stagedChanges
+            if (data != null) {
+                request.putColumnData(column.column, data)
             }
-            for (column in columns) {
-                column.stagedChanges = null
-                column.pendingChanges = null
+        }
+        if (request.columnDataCount > 0) {
+            val response = troveCall { stub.save(request.build()) }.getOrElse { return Result.failure(it) }
+            if (!response.success) {
+                return Result.failure(IllegalStateException(response.errorMessage))
             }
-            return Result.success(Unit)
         }
+        for (column in columns) {
+            column.stagedChanges = null
+        }
+        idempotencyKey = null
+        return Result.success(Unit)
     }
 
     fun stageChanges(column: UserColumn) {
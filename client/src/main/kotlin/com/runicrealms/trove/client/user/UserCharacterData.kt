@@ -1,5 +1,6 @@
 package com.runicrealms.trove.client.user
 
+import com.runicrealms.trove.client.troveCall
 import com.runicrealms.trove.client.user.character.CharacterColumn
 import com.runicrealms.trove.client.user.character.CharacterInventory
 import com.runicrealms.trove.client.user.character.CharacterProfession
@@ -57,12 +58,14 @@ class UserCharacterData internal constructor(
 
     companion object {
         internal suspend fun exists(potential: Potential): Result<Boolean> {
-            val response = potential.stub.exists(
-                ExistsRequest.newBuilder()
-                .setTable(CharacterColumn.Companion.TABLE_NAME)
-                .setLock(potential.lock)
-                .putAllSuperKeys(potential.superKeys)
-                .build())
+            val response = troveCall {
+                potential.stub.exists(
+                    ExistsRequest.newBuilder()
+                    .setTable(CharacterColumn.Companion.TABLE_NAME)
+                    .setLock(potential.lock)
+                    .putAllSuperKeys(potential.superKeys)
+                    .build())
+            }.getOrElse { return Result.failure(it) }
 
             if (!response.success) {
                 return Result.failure(IllegalStateException(response.errorMessage))
@@ -71,28 +74,31 @@ class UserCharacterData internal constructor(
         }
 
         internal suspend fun load(potential: Potential): Result<UserCharacterData> {
-            val response = potential.stub.load(
-                LoadRequest.newBuilder()
-                .setTable(CharacterColumn.Companion.TABLE_NAME)
-                .setLock(potential.lock)
-                .putAllSuperKeys(potential.superKeys)
-                .addAllColumns(listOf<String>(
-                    CharacterInventory.Companion.COLUMN_NAME,
-                    CharacterProfession.Companion.COLUMN_NAME,
-                    CharacterQuests.Companion.COLUMN_NAME,
-                    CharacterSkills.Companion.COLUMN_NAME,
-                    CharacterSpells.Companion.COLUMN_NAME,
-                    CharacterTraits.Companion.COLUMN_NAME
-                ))
-                .build()
-            )
+            val response = troveCall {
+                potential.stub.load(
+                    LoadRequest.newBuilder()
+                    .setTable(CharacterColumn.Companion.TABLE_NAME)
+                    .setLock(potential.lock)
+                    .putAllSuperKeys(potential.superKeys)
+                    .addAllColumns(listOf<String>(
+                        CharacterInventory.Companion.COLUMN_NAME,
+                        CharacterProfession.Companion.COLUMN_NAME,
+                        CharacterQuests.Companion.COLUMN_NAME,
+                        CharacterSkills.Companion.COLUMN_NAME,
+                        CharacterSpells.Companion.COLUMN_NAME,
+                        CharacterTraits.Companion.COLUMN_NAME
+                    ))
+                    .build()
+                )
+            }.getOrElse { return Result.failure(it) }
             if (response.rowsCount > 1) {
                 return Result.failure(IllegalStateException("Too many matching rows for character found, expected 1"))
             }
             if (response.rowsCount == 0) {
                 return Result.failure(IllegalStateException("Could not find rows for character"))
             }
-            val columnData = response.rowsList[0]!!.columnDataMap
+            val row = response.rowsList[0]!!
+            val columnData = row.columnDataMap
 
             if (!response.success) {
                 return Result.failure(IllegalStateException(response.errorMessage))
@@ -125,6 +131,11 @@ class UserCharacterData internal constructor(
                         .toBuilder()
                 ),
                 )
+            with(userCharacterData) {
+                for (column in listOf(inventory, profession, quests, skills, spells, traits)) {
+                    column.quarantined = column.column in row.quarantinedColumnsList
+                }
+            }
             return Result.success(userCharacterData)
         }
 
@@ -1,5 +1,6 @@
 package com.runicrealms.trove.client.user
 
+import com.runicrealms.trove.client.troveCall
 import com.runicrealms.trove.client.user.character.CharacterColumn
 import com.runicrealms.trove.client.user.character.CharacterTraits
 import com.runicrealms.trove.generated.api.schema.v1.character.CharacterTraitsData
@@ -28,19 +29,22 @@ class UserCharactersTraits(
 
     companion object {
         internal suspend fun load(potential: Potential): Result<UserCharactersTraits> {
-            val response = potential.stub.load(
-                LoadRequest.newBuilder()
-                    .setTable(CharacterColumn.Companion.TABLE_NAME)
-                    .setLock(potential.lock)
-                    .putAllSuperKeys(potential.superKeys)
-                    .addAllColumns(
-                        listOf<String>(
-                            "slot",
-                            CharacterTraits.Companion.COLUMN_NAME
+            val response = troveCall {
+                potential.stub.load(
+                    LoadRequest.newBuilder()
+                        .setTable(CharacterColumn.Companion.TABLE_NAME)
+                        .setLock(potential.lock)
+                        .setReadOnly(true) // character select only reads, the full character load transforms and resaves
+                        .putAllSuperKeys(potential.superKeys)
+                        .addAllColumns(
+                            listOf<String>(
+                                "slot",
+                                CharacterTraits.Companion.COLUMN_NAME
+                            )
                         )
-                    )
-                    .build()
-            )
+                        .build()
+                )
+            }.getOrElse { return Result.failure(it) }
             if (!response.success) {
                 return Result.failure(IllegalStateException(response.errorMessage))
             }
@@ -1,5 +1,6 @@
 package com.runicrealms.trove.client.user
 
+import com.runicrealms.trove.client.troveCall
 import com.runicrealms.trove.generated.api.trove.ClaimLockRequest
 import com.runicrealms.trove.generated.api.trove.LockInfo
 import com.runicrealms.trove.generated.api.trove.ReleaseLockRequest
@@ -19,13 +20,15 @@ class UserClaim internal constructor(
         if (!open) {
             return Result.failure(IllegalStateException("Lease has already been closed, please open new claim"))
         }
-        val response = stub.claimLock(
-            ClaimLockRequest.newBuilder()
-                .setUserId(lock.userId)
-                .setServerId(lock.serverId)
-                .setLeaseMillis(leaseMillis)
-                .build()
-        )
+        val response = troveCall {
+            stub.claimLock(
+                ClaimLockRequest.newBuilder()
+                    .setUserId(lock.userId)
+                    .setServerId(lock.serverId)
+                    .setLeaseMillis(leaseMillis)
+                    .build()
+            )
+        }.getOrElse { return Result.failure(it) }
         if (!response.success) {
             return Result.failure(IllegalStateException(response.errorMessage))
         }
@@ -45,12 +48,14 @@ class UserClaim internal constructor(
     }
 
     suspend fun releaseAndClose(): Result<Unit> {
-        val response = stub.releaseLock(
-            ReleaseLockRequest.newBuilder()
-                .setUserId(lock.userId)
-                .setServerId(lock.serverId)
-                .build()
-        )
+        val response = troveCall {
+            stub.releaseLock(
+                ReleaseLockRequest.newBuilder()
+                    .setUserId(lock.userId)
+                    .setServerId(lock.serverId)
+                    .build()
+            )
+        }.getOrElse { return Result.failure(it) }
         if (!response.success) {
             return Result.failure(IllegalStateException(response.errorMessage))
         }
@@ -9,6 +9,14 @@ abstract class UserColumn(
 
     internal abstract fun getRawData(): ByteString
 
+    /**
+     * Set when the server could not transform this column to the latest version, and loaded a fallback in its place.
+     * Quarantined columns are never saved, so the fallback cannot overwrite the player's real data.
+     */
+    @Volatile
+    var quarantined: Boolean = false
+        internal set
+
     @Volatile
     internal var pendingChanges: ByteString? = null
 
@@ -1,5 +1,6 @@
 package com.runicrealms.trove.client.user
 
+import com.runicrealms.trove.client.troveCall
 import com.runicrealms.trove.client.user.player.PlayerAchievements
 import com.runicrealms.trove.client.user.player.PlayerBank
 import com.runicrealms.trove.client.user.player.PlayerColumn
@@ -54,12 +55,14 @@ class UserPlayerData internal constructor(
 
     companion object {
         internal suspend fun exists(potential: Potential): Result<Boolean> {
-            val response = potential.stub.exists(
-                ExistsRequest.newBuilder()
-                .setTable(PlayerColumn.Companion.TABLE_NAME)
-                .setLock(potential.lock)
-                .putAllSuperKeys(potential.superKeys)
-                .build())
+            val response = troveCall {
+                potential.stub.exists(
+                    ExistsRequest.newBuilder()
+                    .setTable(PlayerColumn.Companion.TABLE_NAME)
+                    .setLock(potential.lock)
+                    .putAllSuperKeys(potential.superKeys)
+                    .build())
+            }.getOrElse { return Result.failure(it) }
 
             if (!response.success) {
                 return Result.failure(IllegalStateException(response.errorMessage))
@@ -68,30 +71,33 @@ class UserPlayerData internal constructor(
         }
 
         internal suspend fun load(potential: Potential): Result<UserPlayerData> {
-            val response = potential.stub.load(
-                LoadRequest.newBuilder()
-                    .setTable(PlayerColumn.Companion.TABLE_NAME)
-                    .setLock(potential.lock)
-                    .putAllSuperKeys(potential.superKeys)
-                    .addAllColumns(
-                        listOf<String>(
-                            PlayerAchievements.Companion.COLUMN_NAME,
-                            PlayerBank.Companion.COLUMN_NAME,
-                            PlayerGathering.Companion.COLUMN_NAME,
-                            PlayerMounts.Companion.COLUMN_NAME,
-                            PlayerSettings.Companion.COLUMN_NAME,
-                            PlayerTraits.Companion.COLUMN_NAME
+            val response = troveCall {
+                potential.stub.load(
+                    LoadRequest.newBuilder()
+                        .setTable(PlayerColumn.Companion.TABLE_NAME)
+                        .setLock(potential.lock)
+                        .putAllSuperKeys(potential.superKeys)
+                        .addAllColumns(
+                            listOf<String>(
+                                PlayerAchievements.Companion.COLUMN_NAME,
+                                PlayerBank.Companion.COLUMN_NAME,
+                                PlayerGathering.Companion.COLUMN_NAME,
+                                PlayerMounts.Companion.COLUMN_NAME,
+                                PlayerSettings.Companion.COLUMN_NAME,
+                                PlayerTraits.Companion.COLUMN_NAME
+                            )
                         )
-                    )
-                    .build()
-            )
+                        .build()
+                )
+            }.getOrElse { return Result.failure(it) }
             if (response.rowsCount > 1) {
                 return Result.failure(IllegalStateException("Too many matching rows for player found, expected 1"))
             }
             if (response.rowsCount == 0) {
                 return Result.failure(IllegalStateException("Could not find rows for player"))
             }
-            val columnData = response.rowsList[0]!!.columnDataMap
+            val row = response.rowsList[0]!!
+            val columnData = row.columnDataMap
             if (!response.success) {
                 return Result.failure(IllegalStateException(response.errorMessage))
             }
@@ -120,6 +126,11 @@ class UserPlayerData internal constructor(
                     PlayerTraitsData.parseFrom(columnData[PlayerTraits.Companion.COLUMN_NAME]).toBuilder()
                 )
             )
+            with(userPlayerData) {
+                for (column in listOf(achievements, bank, gathering, mounts, settings, traits)) {
+                    column.quarantined = column.column in row.quarantinedColumnsList
+                }
+            }
             return Result.success(userPlayerData)
         }
 
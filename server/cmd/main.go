@@ -1,42 +1,271 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
 	"github.com/Runic-Studios/Trove/server/internal/transformers"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"github.com/Runic-Studios/Trove/server/internal/config"
 	"github.com/Runic-Studios/Trove/server/internal/db"
+	"github.com/Runic-Studios/Trove/server/internal/logging"
+	"github.com/Runic-Studios/Trove/server/internal/metrics"
 	"github.com/Runic-Studios/Trove/server/internal/service"
+	"github.com/Runic-Studios/Trove/server/internal/tracing"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
+// fatal logs why the server cannot run and exits
+func fatal(msg string, err error, args ...any) {
+	slog.Error(msg, append(args, slog.Any("error", err))...)
+	os.Exit(1)
+}
+
 func main() {
-	sess, err := db.NewSession()
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		log.Fatalf("invalid config: %+v", err)
+	}
+	if err := logging.Setup(cfg.Logging); err != nil {
+		log.Fatalf("failed to set up logging: %+v", err)
+	}
+	slog.Info("loaded config", slog.String("config", cfg.Redacted()))
+
+	if err := transformers.V1Transformer.Validate(); err != nil {
+		fatal("invalid transformer chain", err)
+	}
+
+	stopTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
 	if err != nil {
-		log.Fatalf("failed to create scylla session: %+v", err)
+		fatal("failed to set up tracing", err)
 	}
-	defer sess.Close()
 
-	port := os.Getenv("TROVE_SERVER_PORT")
-	if port == "" {
-		port = "9090"
-		fmt.Printf("Warning: TROVE_SERVER_PORT environment variable, not set, defaulting to %s\n", port)
+	if err := db.SetCompression(cfg.Compression); err != nil {
+		fatal("invalid compression config", err)
+	}
+	if err := db.SetEncryption(cfg.Encryption); err != nil {
+		fatal("invalid encryption config", err)
 	}
 
-	lis, err := net.Listen("tcp", ":"+port)
+	sess, err := db.NewSession(cfg.Cluster, tracing.QueryObserver{Next: metrics.QueryObserver{}})
 	if err != nil {
-		log.Fatalf("failed to listen on :%s, %+v", port, err)
+		fatal("failed to create scylla session", err)
 	}
 
-	grpcServer := grpc.NewServer()
-	srv := service.NewTroveServer(sess, transformers.V1Transformer)
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", cfg.Server.Port))
+	if err != nil {
+		fatal("failed to listen", err, slog.Int("port", cfg.Server.Port))
+	}
+
+	quarantine := service.QuarantinePolicy{
+		ColumnFallbacks: make(map[string]service.Fallback, len(cfg.Transformers.ColumnFallbacks)),
+		Alert: func(q db.QuarantinedRow) {
+			slog.Error("ALERT: quarantined column",
+				slog.String("table", q.Table), slog.String("column", q.Column), slog.String("row_key", q.RowKey),
+				slog.String("version", q.SchemaVersion), slog.String("error", q.Error))
+		},
+	}
+	if quarantine.Fallback, err = service.ParseFallback(cfg.Transformers.Fallback); err != nil {
+		fatal("invalid transformers config", err)
+	}
+	for column, name := range cfg.Transformers.ColumnFallbacks {
+		if quarantine.ColumnFallbacks[column], err = service.ParseFallback(name); err != nil {
+			fatal("invalid transformers config", err)
+		}
+	}
+
+	rpcs := &service.RPCTracker{}
+	idempotency := service.NewIdempotencyCache(cfg.Server.IdempotencyTTL)
+	unary := []grpc.UnaryServerInterceptor{
+		// outermost, so logs and metrics see the real failure even when legacy clients are answered with success=false
+		service.UnaryStatusInterceptor,
+		rpcs.UnaryInterceptor,
+		service.UnaryLoggingInterceptor,
+		metrics.UnaryInterceptor,
+	}
+	stream := []grpc.StreamServerInterceptor{
+		rpcs.StreamInterceptor,
+		service.StreamLoggingInterceptor,
+		metrics.StreamInterceptor,
+	}
+	if cfg.Auth.Enabled {
+		auth, err := newAuthenticator(cfg.Auth)
+		if err != nil {
+			fatal("invalid auth config", err)
+		}
+		unary = append(unary, auth.UnaryInterceptor)
+		stream = append(stream, auth.StreamInterceptor)
+	} else {
+		slog.Warn("auth is disabled, any caller may act as any server")
+	}
+	limiter := service.NewLimiter(service.LimitPolicy{
+		PerServer:       service.RateLimit(cfg.Limits.PerServer),
+		PerUser:         service.RateLimit(cfg.Limits.PerUser),
+		MaxColumns:      cfg.Limits.MaxColumns,
+		MaxBlobBytes:    cfg.Limits.MaxBlobBytes,
+		ColumnBlobBytes: cfg.Limits.ColumnBlobBytes,
+	})
+	unary = append(unary,
+		limiter.UnaryInterceptor,
+		service.UnaryTracingInterceptor,
+		service.UnaryTimeoutInterceptor,
+		idempotency.UnaryInterceptor,
+	)
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+	if cfg.Server.TLS.Enabled {
+		creds, err := serverCredentials(cfg.Server.TLS)
+		if err != nil {
+			fatal("invalid server TLS config", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	grpcServer := grpc.NewServer(opts...)
+	srv := service.NewTroveServer(sess, transformers.V1Transformer, quarantine,
+		cfg.Server.PublicColumns, service.NewLocalFanout(), service.LockPolicy{
+			MinLease:         cfg.Locks.MinLease,
+			MaxLease:         cfg.Locks.MaxLease,
+			EvictionInterval: cfg.Locks.EvictionInterval,
+		})
 	trove.RegisterTroveServiceServer(grpcServer, srv)
 
-	fmt.Printf("Trove-Server listening on :%s\n", port)
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve gRPC: %+v", err)
+	health := service.NewHealth(sess, srv)
+	healthpb.RegisterHealthServer(grpcServer, health.GRPC())
+	reflection.Register(grpcServer)
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	go health.Run(healthCtx)
+	reencryptCtx, stopReencrypt := context.WithCancel(context.Background())
+	if len(cfg.Encryption.Columns) > 0 && cfg.Encryption.ReencryptInterval > 0 {
+		go service.NewReencryptor(sess, cfg.Encryption.Columns, cfg.Encryption.ReencryptInterval).Run(reencryptCtx)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", health.Handler())
+	mux.Handle("/metrics", promhttp.Handler())
+	healthServer := &http.Server{Addr: fmt.Sprintf(":%d", cfg.Server.HealthPort), Handler: mux}
+	go func() {
+		slog.Info("Trove-Server health and metrics endpoints listening", slog.Int("port", cfg.Server.HealthPort))
+		if err := healthServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("failed to serve health endpoints", err)
+		}
+	}()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Trove-Server listening", slog.Int("port", cfg.Server.Port))
+		serveErr <- grpcServer.Serve(lis)
+	}()
+
+	signals, stopSignals := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stopSignals()
+	select {
+	case err := <-serveErr:
+		fatal("failed to serve gRPC", err)
+	case <-signals.Done():
+	}
+
+	// stop taking new traffic, end open streams, then let in-flight RPCs finish
+	slog.Info("Trove-Server shutting down")
+	health.Shutdown()
+	srv.Close()
+	stopReencrypt()
+	inFlight := rpcs.InFlight()
+	stopped := make(chan struct{})
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		slog.Info("drained RPCs", slog.Int64("drained", inFlight))
+	case <-time.After(cfg.Server.ShutdownTimeout):
+		cutOff := rpcs.InFlight()
+		grpcServer.Stop()
+		slog.Warn("cut off RPCs still running after the shutdown timeout",
+			slog.Int64("drained", inFlight-cutOff), slog.Int64("cut_off", cutOff), slog.Duration("timeout", cfg.Server.ShutdownTimeout))
+	}
+
+	idempotency.Close()
+	limiter.Close()
+	stopHealth()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := healthServer.Shutdown(ctx); err != nil {
+		slog.Error("failed to stop health endpoints", slog.Any("error", err))
+	}
+	sess.Close()
+	if err := stopTracing(ctx); err != nil {
+		slog.Error("failed to flush traces", slog.Any("error", err))
+	}
+	slog.Info("Trove-Server stopped")
+}
+
+// serverCredentials loads the gRPC server's certificate, and the CA verifying client certificates for mTLS.
+func serverCredentials(cfg config.ServerTLS) (credentials.TransportCredentials, error) {
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		tlsConfig.ClientCAs = x509.NewCertPool()
+		if !tlsConfig.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.ClientCAFile)
+		}
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if cfg.RequireClientCert {
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// newAuthenticator creates the authenticator for the configured principals.
+func newAuthenticator(cfg config.Auth) (*service.Authenticator, error) {
+	principals := make([]service.Principal, len(cfg.Principals))
+	for i, p := range cfg.Principals {
+		principals[i] = service.Principal{
+			Name:      p.Name,
+			Role:      service.Role(p.Role),
+			ServerIDs: p.ServerIDs,
+		}
+		if p.TokenSHA256 != "" {
+			hash, err := hex.DecodeString(p.TokenSHA256)
+			if err != nil {
+				return nil, fmt.Errorf("invalid token_sha256 of %s: %w", p.Name, err)
+			}
+			principals[i].TokenSHA256 = hash
+		}
 	}
+	return service.NewAuthenticator(principals), nil
 }
@@ -0,0 +1,196 @@
+// Command trove-migrate starts, stops and reports on background migrations through a running trove-server.
+//
+//	trove-migrate start -table players [-rate 50] [-restart] [-wait]
+//	trove-migrate stop -table players
+//	trove-migrate status -table players [-count-remaining]
+//
+// The migration itself runs on the server that receives the call, so that it holds the same row locks
+// as game servers and publishes every migrated row to that server's watchers.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// statusInterval is how often start -wait polls the migration's progress
+const statusInterval = 10 * time.Second
+
+const usage = `usage: trove-migrate <start|stop|status> -table <table> [flags]
+
+The bearer token of an admin principal, if auth is enabled, is read from TROVE_TOKEN.
+`
+
+func main() {
+	if len(os.Args) < 2 || !slices.Contains([]string{"start", "stop", "status"}, os.Args[1]) {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	command := os.Args[1]
+
+	fs := flag.NewFlagSet("trove-migrate "+command, flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	addr := fs.String("addr", "localhost:9090", "trove-server gRPC address")
+	table := fs.String("table", "", "table to migrate")
+	useTLS := fs.Bool("tls", false, "connect with TLS")
+	caFile := fs.String("ca-file", "", "CA verifying the server's certificate, defaults to the system roots")
+	certFile := fs.String("cert-file", "", "client certificate, for mTLS")
+	keyFile := fs.String("key-file", "", "client certificate key, for mTLS")
+	rate := fs.Int("rate", 0, "start: max rows rewritten per second, 0 for the server's default")
+	restart := fs.Bool("restart", false, "start: ignore the stored checkpoint and scan from the beginning")
+	wait := fs.Bool("wait", false, "start: report progress until the migration stops")
+	countRemaining := fs.Bool("count-remaining", false, "status: also scan the table to count rows below the latest version")
+	_ = fs.Parse(os.Args[2:])
+	if *table == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	creds := insecure.NewCredentials()
+	token := os.Getenv("TROVE_TOKEN")
+	if *useTLS {
+		tlsCreds, err := clientCredentials(*caFile, *certFile, *keyFile)
+		if err != nil {
+			fail(err)
+		}
+		creds = tlsCreds
+	} else if token != "" {
+		fail(errors.New("TROVE_TOKEN needs -tls, or the token would be sent in plaintext"))
+	}
+	conn, err := grpc.NewClient(*addr, grpc.WithTransportCredentials(creds))
+	if err != nil {
+		fail(fmt.Errorf("failed to connect to %s: %w", *addr, err))
+	}
+	defer conn.Close()
+	client := trove.NewTroveServiceClient(conn)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	if token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+
+	switch command {
+	case "start":
+		_, err = client.StartMigration(ctx, &trove.StartMigrationRequest{
+			Table:         *table,
+			RowsPerSecond: int32(*rate),
+			Restart:       *restart,
+		})
+		if err != nil {
+			fail(err)
+		}
+		fmt.Printf("started migration of %s\n", *table)
+		if *wait {
+			err = waitForMigration(ctx, client, *table)
+		}
+	case "stop":
+		if _, err = client.StopMigration(ctx, &trove.StopMigrationRequest{Table: *table}); err == nil {
+			fmt.Printf("stopped migration of %s, start it again to resume\n", *table)
+		}
+	case "status":
+		var resp *trove.MigrationStatusResponse
+		resp, err = client.MigrationStatus(ctx, &trove.MigrationStatusRequest{Table: *table, CountRemaining: *countRemaining})
+		if err == nil {
+			printStatus(*table, resp)
+		}
+	}
+	if err != nil {
+		fail(err)
+	}
+}
+
+// waitForMigration prints the progress of the migration of table until it stops.
+// Interrupting it leaves the migration running on the server.
+func waitForMigration(ctx context.Context, client trove.TroveServiceClient, table string) error {
+	ticker := time.NewTicker(statusInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		resp, err := client.MigrationStatus(ctx, &trove.MigrationStatusRequest{Table: table})
+		if err != nil {
+			return err
+		}
+		printStatus(table, resp)
+		if !resp.GetRunning() {
+			if resp.GetLastError() != "" {
+				return errors.New(resp.GetLastError())
+			}
+			return nil
+		}
+	}
+}
+
+// printStatus prints a migration's progress on a single line, followed by any remaining rows per version.
+func printStatus(table string, resp *trove.MigrationStatusResponse) {
+	state := "stopped"
+	if resp.GetRunning() {
+		state = "running"
+	}
+	fmt.Printf("%s: %s, to version %s, %d/%d ranges, %d migrated, %d skipped, %d failed\n",
+		table, state, resp.GetTargetVersion(), resp.GetCompletedRanges(), resp.GetTotalRanges(),
+		resp.GetMigrated(), resp.GetSkipped(), resp.GetFailed())
+	if resp.GetLastError() != "" {
+		fmt.Printf("  last error: %s\n", resp.GetLastError())
+	}
+	remaining := resp.GetRemainingByVersion()
+	versions := make([]string, 0, len(remaining))
+	for version := range remaining {
+		versions = append(versions, version)
+	}
+	slices.Sort(versions)
+	for _, version := range versions {
+		fmt.Printf("  %d rows remaining at %s\n", remaining[version], version)
+	}
+}
+
+// clientCredentials loads the CA verifying the server and, for mTLS, the client's certificate.
+func clientCredentials(caFile, certFile, keyFile string) (credentials.TransportCredentials, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+		}
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// fail prints why the command failed and exits
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "trove-migrate: %v\n", err)
+	os.Exit(1)
+}
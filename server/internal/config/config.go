@@ -0,0 +1,601 @@
+// Package config loads the settings of the trove-server from a YAML file, env vars and flags.
+package config
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets when the config is printed
+const redacted = "[redacted]"
+
+// keyspacePattern matches the unquoted CQL identifiers a keyspace can be named with
+var keyspacePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,47}$`)
+
+// Config holds every setting of the trove-server.
+type Config struct {
+	Server       Server       `yaml:"server"`
+	Cluster      Cluster      `yaml:"cluster"`
+	Locks        Locks        `yaml:"locks"`
+	Transformers Transformers `yaml:"transformers"`
+	Logging      Logging      `yaml:"logging"`
+	Tracing      Tracing      `yaml:"tracing"`
+	Auth         Auth         `yaml:"auth"`
+	Limits       Limits       `yaml:"limits"`
+	Compression  Compression  `yaml:"compression"`
+	Encryption   Encryption   `yaml:"encryption"`
+}
+
+// Server configures the gRPC and HTTP endpoints.
+type Server struct {
+	Port       int `yaml:"port"`
+	HealthPort int `yaml:"health_port"`
+	// PublicColumns are the "table.column"s anyone may read through PublicLoad
+	PublicColumns []string `yaml:"public_columns"`
+	// ShutdownTimeout is how long in-flight RPCs are given to finish on SIGTERM
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// IdempotencyTTL is how long a successful response is replayed for a repeated idempotency key
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl"`
+	TLS            ServerTLS     `yaml:"tls"`
+}
+
+// ServerTLS configures TLS on the gRPC endpoint. Setting ClientCAFile turns on mTLS.
+type ServerTLS struct {
+	Enabled  bool   `yaml:"enabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// ClientCAFile verifies the certificates clients present
+	ClientCAFile string `yaml:"client_ca_file"`
+	// RequireClientCert rejects connections without a verified client certificate
+	RequireClientCert bool `yaml:"require_client_cert"`
+}
+
+// Cluster configures the connection to Scylla.
+type Cluster struct {
+	Hosts    []string `yaml:"hosts"`
+	Port     int      `yaml:"port"`
+	Keyspace string   `yaml:"keyspace"`
+	// LocalDC, if set, routes queries to hosts of that datacenter first
+	LocalDC  string `yaml:"local_dc"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Consistency is the consistency level of each kind of operation
+	Consistency    Consistency   `yaml:"consistency"`
+	Timeout        time.Duration `yaml:"timeout"`
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+	TLS            ClusterTLS    `yaml:"tls"`
+	// TokenAware sends each query straight to a replica owning its partition
+	TokenAware bool  `yaml:"token_aware"`
+	Retry      Retry `yaml:"retry"`
+	// SpeculativeExecution re-sends slow idempotent queries to another host
+	SpeculativeExecution SpeculativeExecution `yaml:"speculative_execution"`
+	// ConnectionsPerHost is the size of the connection pool to each host
+	ConnectionsPerHost int `yaml:"connections_per_host"`
+}
+
+// ClusterTLS configures client TLS to Scylla. The cert and key are only needed when Scylla requires client certificates.
+type ClusterTLS struct {
+	Enabled  bool   `yaml:"enabled"`
+	CAFile   string `yaml:"ca_file"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// VerifyHost checks that each node's certificate is valid for its address
+	VerifyHost bool `yaml:"verify_host"`
+}
+
+// Retry configures how failed queries are retried, with exponential backoff.
+type Retry struct {
+	MaxRetries int           `yaml:"max_retries"`
+	MinBackoff time.Duration `yaml:"min_backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// SpeculativeExecution configures how many extra attempts a slow idempotent query gets, and after how long.
+// Zero attempts disables it.
+type SpeculativeExecution struct {
+	Attempts int           `yaml:"attempts"`
+	Delay    time.Duration `yaml:"delay"`
+}
+
+// Consistency names the consistency level of reads, writes and lock LWTs, and the serial consistency of LWTs.
+type Consistency struct {
+	Read   string `yaml:"read"`
+	Write  string `yaml:"write"`
+	Lock   string `yaml:"lock"`
+	Serial string `yaml:"serial"`
+}
+
+// Locks bounds the leases game servers can claim.
+type Locks struct {
+	MinLease time.Duration `yaml:"min_lease"`
+	MaxLease time.Duration `yaml:"max_lease"`
+	// EvictionInterval is how often expired in-memory locks are purged
+	EvictionInterval time.Duration `yaml:"eviction_interval"`
+}
+
+// Transformers configures what happens to rows that fail to transform.
+type Transformers struct {
+	// Fallback is what Load returns for a column whose transform failed: "fail", "raw" or "default"
+	Fallback string `yaml:"fallback"`
+	// ColumnFallbacks overrides Fallback per "table.column"
+	ColumnFallbacks map[string]string `yaml:"column_fallbacks"`
+}
+
+// Logging configures the structured logger.
+type Logging struct {
+	// Level is debug, info, warn or error
+	Level string `yaml:"level"`
+	// Format is text or json
+	Format string `yaml:"format"`
+}
+
+// Tracing configures where spans are exported.
+type Tracing struct {
+	// Exporter is otlp, stdout, or empty to disable tracing
+	Exporter string `yaml:"exporter"`
+}
+
+// Auth configures who may call the gRPC endpoint, and what each caller may do.
+type Auth struct {
+	// Enabled rejects callers that do not authenticate as one of Principals
+	Enabled    bool        `yaml:"enabled"`
+	Principals []Principal `yaml:"principals"`
+}
+
+// Principal is a caller, identified by its client certificate or by a bearer token.
+type Principal struct {
+	// Name is matched against the common name and DNS and URI SANs of a verified client certificate
+	Name string `yaml:"name"`
+	// TokenSHA256 is the hex SHA-256 of the bearer token the caller may authenticate with instead
+	TokenSHA256 string `yaml:"token_sha256"`
+	// Role is game_server, proxy, admin or analytics
+	Role string `yaml:"role"`
+	// ServerIDs are the server_ids the caller may claim locks as, defaulting to its name
+	ServerIDs []string `yaml:"server_ids"`
+}
+
+// Limits bounds how often each caller may call, and how much a single request may carry.
+// Zero leaves a limit off.
+type Limits struct {
+	// PerServer limits the requests made as each server_id, or by each authenticated caller without one
+	PerServer RateLimit `yaml:"per_server"`
+	// PerUser limits the requests about each player
+	PerUser RateLimit `yaml:"per_user"`
+	// MaxColumns is the most columns a request may save or load
+	MaxColumns int `yaml:"max_columns"`
+	// MaxBlobBytes is the largest blob a request may write to a column
+	MaxBlobBytes int `yaml:"max_blob_bytes"`
+	// ColumnBlobBytes overrides MaxBlobBytes per "table.column"
+	ColumnBlobBytes map[string]int `yaml:"column_blob_bytes"`
+}
+
+// RateLimit allows Rate requests per second on average, in bursts of up to Burst.
+type RateLimit struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
+}
+
+// Compression configures which columns are compressed when saved.
+type Compression struct {
+	// Columns is the codec of each "table.column": none, snappy or zstd
+	Columns map[string]string `yaml:"columns"`
+	// MinBytes is the size below which blobs are stored uncompressed
+	MinBytes int `yaml:"min_bytes"`
+}
+
+// Encryption configures which columns are encrypted at rest, and the keys they are encrypted with.
+type Encryption struct {
+	// KeyringFile is a YAML file of base64 AES-256 keys by id, naming the primary key new blobs are sealed with
+	KeyringFile string `yaml:"keyring_file"`
+	// Columns are the "table.column"s encrypted at rest
+	Columns []string `yaml:"columns"`
+	// ReencryptInterval is how often blobs sealed with an older key, or stored before their column was encrypted,
+	// are re-sealed with the primary key. Zero, the default, disables re-encryption on this server; set it on
+	// one replica only, since every replica with it set scans every encrypted column.
+	ReencryptInterval time.Duration `yaml:"reencrypt_interval"`
+}
+
+// Default returns the settings used for everything the file, env vars and flags leave out.
+func Default() Config {
+	return Config{
+		Server: Server{
+			Port:            9090,
+			HealthPort:      8081,
+			ShutdownTimeout: 25 * time.Second,
+			IdempotencyTTL:  10 * time.Minute,
+		},
+		Cluster: Cluster{
+			Hosts:    []string{"127.0.0.1"},
+			Port:     9042,
+			Keyspace: "trove",
+			Consistency: Consistency{
+				Read:   "QUORUM",
+				Write:  "QUORUM",
+				Lock:   "QUORUM",
+				Serial: "SERIAL",
+			},
+			Timeout:        11 * time.Second,
+			ConnectTimeout: 11 * time.Second,
+			TLS: ClusterTLS{
+				VerifyHost: true,
+			},
+			TokenAware: true,
+			Retry: Retry{
+				MaxRetries: 3,
+				MinBackoff: 100 * time.Millisecond,
+				MaxBackoff: 2 * time.Second,
+			},
+			SpeculativeExecution: SpeculativeExecution{
+				Delay: 100 * time.Millisecond,
+			},
+			ConnectionsPerHost: 2,
+		},
+		Locks: Locks{
+			MinLease:         time.Second,
+			MaxLease:         time.Hour,
+			EvictionInterval: time.Minute,
+		},
+		Transformers: Transformers{
+			Fallback: "fail",
+		},
+		Logging: Logging{
+			Level:  "info",
+			Format: "text",
+		},
+		Compression: Compression{
+			MinBytes: 256,
+		},
+	}
+}
+
+// Load builds the config from the defaults, overridden by the YAML file named by -config or TROVE_CONFIG,
+// then by env vars, then by flags. The result is validated.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	fs := flag.NewFlagSet("trove-server", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv("TROVE_CONFIG"), "path to the YAML config file")
+	var overrides Config
+	fs.IntVar(&overrides.Server.Port, "port", 0, "gRPC port")
+	fs.IntVar(&overrides.Server.HealthPort, "health-port", 0, "health and metrics HTTP port")
+	hosts := fs.String("scylla-hosts", "", "comma-separated Scylla contact points")
+	fs.IntVar(&overrides.Cluster.Port, "scylla-port", 0, "Scylla CQL port")
+	fs.StringVar(&overrides.Cluster.Keyspace, "scylla-keyspace", "", "Scylla keyspace")
+	fs.StringVar(&overrides.Cluster.LocalDC, "scylla-local-dc", "", "Scylla datacenter to prefer")
+	fs.StringVar(&overrides.Logging.Level, "log-level", "", "log level: debug, info, warn or error")
+	fs.StringVar(&overrides.Logging.Format, "log-format", "", "log format: text or json")
+	fs.StringVar(&overrides.Tracing.Exporter, "traces-exporter", "", "trace exporter: otlp or stdout")
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+
+	if *path != "" {
+		data, err := os.ReadFile(*path)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read config file: %w", err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+			return Config{}, fmt.Errorf("failed to parse config file %s: %w", *path, err)
+		}
+	}
+
+	if err := cfg.applyEnv(); err != nil {
+		return Config{}, err
+	}
+
+	// only flags given on the command line override, so their zero defaults do not
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "port":
+			cfg.Server.Port = overrides.Server.Port
+		case "health-port":
+			cfg.Server.HealthPort = overrides.Server.HealthPort
+		case "scylla-hosts":
+			cfg.Cluster.Hosts = splitList(*hosts)
+		case "scylla-port":
+			cfg.Cluster.Port = overrides.Cluster.Port
+		case "scylla-keyspace":
+			cfg.Cluster.Keyspace = overrides.Cluster.Keyspace
+		case "scylla-local-dc":
+			cfg.Cluster.LocalDC = overrides.Cluster.LocalDC
+		case "log-level":
+			cfg.Logging.Level = overrides.Logging.Level
+		case "log-format":
+			cfg.Logging.Format = overrides.Logging.Format
+		case "traces-exporter":
+			cfg.Tracing.Exporter = overrides.Tracing.Exporter
+		}
+	})
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// applyEnv overrides the config with the env vars that are set.
+func (c *Config) applyEnv() error {
+	var errs []error
+	envString := func(name string, dst *string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = v
+		}
+	}
+	envInt := func(name string, dst *int) {
+		if v, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s %q: %w", name, v, err))
+				return
+			}
+			*dst = n
+		}
+	}
+	envList := func(name string, dst *[]string) {
+		if v, ok := os.LookupEnv(name); ok {
+			*dst = splitList(v)
+		}
+	}
+
+	envInt("TROVE_SERVER_PORT", &c.Server.Port)
+	envInt("TROVE_HEALTH_PORT", &c.Server.HealthPort)
+	envList("TROVE_PUBLIC_COLUMNS", &c.Server.PublicColumns)
+	envList("SCYLLA_HOSTS", &c.Cluster.Hosts)
+	envInt("SCYLLA_PORT", &c.Cluster.Port)
+	envString("SCYLLA_KEYSPACE", &c.Cluster.Keyspace)
+	envString("SCYLLA_LOCAL_DC", &c.Cluster.LocalDC)
+	envString("SCYLLA_USERNAME", &c.Cluster.Username)
+	envString("SCYLLA_PASSWORD", &c.Cluster.Password)
+	envString("SCYLLA_TLS_CA_FILE", &c.Cluster.TLS.CAFile)
+	envString("SCYLLA_TLS_CERT_FILE", &c.Cluster.TLS.CertFile)
+	envString("SCYLLA_TLS_KEY_FILE", &c.Cluster.TLS.KeyFile)
+	envString("TROVE_LOG_LEVEL", &c.Logging.Level)
+	envString("TROVE_LOG_FORMAT", &c.Logging.Format)
+	envString("TROVE_TRACES_EXPORTER", &c.Tracing.Exporter)
+	envString("TROVE_TLS_CERT_FILE", &c.Server.TLS.CertFile)
+	envString("TROVE_TLS_KEY_FILE", &c.Server.TLS.KeyFile)
+	envString("TROVE_TLS_CLIENT_CA_FILE", &c.Server.TLS.ClientCAFile)
+	envString("TROVE_KEYRING_FILE", &c.Encryption.KeyringFile)
+	return errors.Join(errs...)
+}
+
+// Validate checks every setting, reporting all problems at once.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	checkFiles := func(section string, files map[string]string) {
+		names := make([]string, 0, len(files))
+		for name := range files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if path := files[name]; path != "" {
+				_, err := os.Stat(path)
+				check(err == nil, "%s.%s: %v", section, name, err)
+			}
+		}
+	}
+
+	check(validPort(c.Server.Port), "server.port %d is not a valid port", c.Server.Port)
+	check(validPort(c.Server.HealthPort), "server.health_port %d is not a valid port", c.Server.HealthPort)
+	check(c.Server.Port != c.Server.HealthPort, "server.port and server.health_port must differ")
+	for _, column := range c.Server.PublicColumns {
+		check(validColumn(column), "server.public_columns entry %q must be of the form table.column", column)
+	}
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Server.IdempotencyTTL > 0, "server.idempotency_ttl must be positive")
+	if c.Server.TLS.Enabled {
+		check(c.Server.TLS.CertFile != "" && c.Server.TLS.KeyFile != "",
+			"server.tls.cert_file and server.tls.key_file are required when server.tls is enabled")
+		check(!c.Server.TLS.RequireClientCert || c.Server.TLS.ClientCAFile != "",
+			"server.tls.require_client_cert needs server.tls.client_ca_file")
+		checkFiles("server.tls", map[string]string{
+			"cert_file":      c.Server.TLS.CertFile,
+			"key_file":       c.Server.TLS.KeyFile,
+			"client_ca_file": c.Server.TLS.ClientCAFile,
+		})
+	} else {
+		check(c.Server.TLS.CertFile == "" && c.Server.TLS.KeyFile == "" && c.Server.TLS.ClientCAFile == "",
+			"server.tls files are set but server.tls.enabled is false")
+	}
+
+	check(len(c.Cluster.Hosts) > 0, "cluster.hosts must list at least one host")
+	for _, host := range c.Cluster.Hosts {
+		check(host != "", "cluster.hosts must not contain empty hosts")
+	}
+	check(validPort(c.Cluster.Port), "cluster.port %d is not a valid port", c.Cluster.Port)
+	check(keyspacePattern.MatchString(c.Cluster.Keyspace), "cluster.keyspace %q is not a valid keyspace name", c.Cluster.Keyspace)
+	check(c.Cluster.Password == "" || c.Cluster.Username != "", "cluster.password is set without cluster.username")
+	for _, op := range []struct{ name, level string }{
+		{"read", c.Cluster.Consistency.Read},
+		{"write", c.Cluster.Consistency.Write},
+		{"lock", c.Cluster.Consistency.Lock},
+	} {
+		_, err := gocql.ParseConsistencyWrapper(op.level)
+		check(err == nil, "cluster.consistency.%s %q is not a consistency level", op.name, op.level)
+	}
+	check(validSerial(c.Cluster.Consistency.Serial),
+		"cluster.consistency.serial %q must be SERIAL or LOCAL_SERIAL", c.Cluster.Consistency.Serial)
+	check(c.Cluster.Timeout > 0, "cluster.timeout must be positive")
+	check(c.Cluster.ConnectTimeout > 0, "cluster.connect_timeout must be positive")
+	if c.Cluster.TLS.Enabled {
+		check((c.Cluster.TLS.CertFile == "") == (c.Cluster.TLS.KeyFile == ""),
+			"cluster.tls.cert_file and cluster.tls.key_file must be set together")
+		checkFiles("cluster.tls", map[string]string{
+			"ca_file":   c.Cluster.TLS.CAFile,
+			"cert_file": c.Cluster.TLS.CertFile,
+			"key_file":  c.Cluster.TLS.KeyFile,
+		})
+	} else {
+		check(c.Cluster.TLS.CAFile == "" && c.Cluster.TLS.CertFile == "" && c.Cluster.TLS.KeyFile == "",
+			"cluster.tls files are set but cluster.tls.enabled is false")
+	}
+	check(c.Cluster.Retry.MaxRetries >= 0, "cluster.retry.max_retries must not be negative")
+	check(c.Cluster.Retry.MinBackoff > 0 && c.Cluster.Retry.MaxBackoff >= c.Cluster.Retry.MinBackoff,
+		"cluster.retry backoffs must be positive, with max_backoff not shorter than min_backoff")
+	check(c.Cluster.SpeculativeExecution.Attempts >= 0, "cluster.speculative_execution.attempts must not be negative")
+	check(c.Cluster.SpeculativeExecution.Attempts == 0 || c.Cluster.SpeculativeExecution.Delay > 0,
+		"cluster.speculative_execution.delay must be positive")
+	check(c.Cluster.ConnectionsPerHost > 0, "cluster.connections_per_host must be positive")
+
+	check(c.Locks.MinLease > 0, "locks.min_lease must be positive")
+	check(c.Locks.MaxLease >= c.Locks.MinLease, "locks.max_lease must not be shorter than locks.min_lease")
+	check(c.Locks.EvictionInterval > 0, "locks.eviction_interval must be positive")
+
+	check(validFallback(c.Transformers.Fallback),
+		"transformers.fallback %q must be fail, raw or default", c.Transformers.Fallback)
+	for column, fallback := range c.Transformers.ColumnFallbacks {
+		check(validColumn(column), "transformers.column_fallbacks key %q must be of the form table.column", column)
+		check(validFallback(fallback),
+			"transformers.column_fallbacks.%s %q must be fail, raw or default", column, fallback)
+	}
+
+	switch strings.ToLower(c.Logging.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "logging.level %q must be debug, info, warn or error", c.Logging.Level)
+	}
+	switch strings.ToLower(c.Logging.Format) {
+	case "text", "json":
+	default:
+		check(false, "logging.format %q must be text or json", c.Logging.Format)
+	}
+	switch c.Tracing.Exporter {
+	case "", "otlp", "stdout":
+	default:
+		check(false, "tracing.exporter %q must be otlp or stdout", c.Tracing.Exporter)
+	}
+
+	check(!c.Auth.Enabled || len(c.Auth.Principals) > 0, "auth.principals must not be empty when auth is enabled")
+	names := make(map[string]bool, len(c.Auth.Principals))
+	for i, p := range c.Auth.Principals {
+		check(p.Name != "", "auth.principals[%d].name is required", i)
+		check(!names[p.Name], "auth.principals[%d].name %q is used twice", i, p.Name)
+		names[p.Name] = true
+		switch p.Role {
+		case "game_server", "proxy", "admin", "analytics":
+		default:
+			check(false, "auth.principals[%d].role %q must be game_server, proxy, admin or analytics", i, p.Role)
+		}
+		if p.TokenSHA256 != "" {
+			hash, err := hex.DecodeString(p.TokenSHA256)
+			check(err == nil && len(hash) == sha256.Size, "auth.principals[%d].token_sha256 must be a hex SHA-256", i)
+			check(c.Server.TLS.Enabled,
+				"auth.principals[%d].token_sha256 needs server.tls.enabled, or the token would be sent in plaintext", i)
+		}
+	}
+
+	for _, limit := range []struct {
+		name string
+		RateLimit
+	}{{"per_server", c.Limits.PerServer}, {"per_user", c.Limits.PerUser}} {
+		check(limit.Rate >= 0, "limits.%s.rate must not be negative", limit.name)
+		check(limit.Rate == 0 || limit.Burst > 0, "limits.%s.burst must be positive", limit.name)
+	}
+	check(c.Limits.MaxColumns >= 0, "limits.max_columns must not be negative")
+	check(c.Limits.MaxBlobBytes >= 0, "limits.max_blob_bytes must not be negative")
+	for column, size := range c.Limits.ColumnBlobBytes {
+		check(validColumn(column), "limits.column_blob_bytes key %q must be of the form table.column", column)
+		check(size >= 0, "limits.column_blob_bytes.%s must not be negative", column)
+	}
+
+	for column, codec := range c.Compression.Columns {
+		check(validColumn(column), "compression.columns key %q must be of the form table.column", column)
+		check(validCodec(codec), "compression.columns.%s %q must be none, snappy or zstd", column, codec)
+	}
+	check(c.Compression.MinBytes >= 0, "compression.min_bytes must not be negative")
+
+	check(len(c.Encryption.Columns) == 0 || c.Encryption.KeyringFile != "",
+		"encryption.keyring_file is required when encryption.columns are set")
+	checkFiles("encryption", map[string]string{"keyring_file": c.Encryption.KeyringFile})
+	for _, column := range c.Encryption.Columns {
+		check(validColumn(column), "encryption.columns entry %q must be of the form table.column", column)
+	}
+	check(c.Encryption.ReencryptInterval >= 0, "encryption.reencrypt_interval must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns the config as YAML, with secrets replaced, for printing at startup.
+func (c Config) Redacted() string {
+	if c.Cluster.Password != "" {
+		c.Cluster.Password = redacted
+	}
+	principals := make([]Principal, len(c.Auth.Principals))
+	for i, p := range c.Auth.Principals {
+		if p.TokenSHA256 != "" {
+			p.TokenSHA256 = redacted
+		}
+		principals[i] = p
+	}
+	c.Auth.Principals = principals
+	out, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("failed to print config: %v", err)
+	}
+	return string(out)
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func validPort(port int) bool {
+	return port > 0 && port <= 65535
+}
+
+func validColumn(column string) bool {
+	table, col, ok := strings.Cut(column, ".")
+	return ok && table != "" && col != "" && !strings.Contains(col, ".")
+}
+
+func validSerial(level string) bool {
+	switch strings.ToUpper(level) {
+	case "SERIAL", "LOCAL_SERIAL":
+		return true
+	}
+	return false
+}
+
+func validFallback(fallback string) bool {
+	switch fallback {
+	case "fail", "raw", "default":
+		return true
+	}
+	return false
+}
+
+func validCodec(codec string) bool {
+	switch codec {
+	case "none", "snappy", "zstd":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+package db
+
+import (
+	"fmt"
+
+	"github.com/Runic-Studios/Trove/server/internal/config"
+	"github.com/Runic-Studios/Trove/server/internal/metrics"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// === BLOB COMPRESSION ===
+
+// Codec is the header byte marking how a stored blob is compressed or encrypted.
+//
+// Blobs are protobuf messages, and a protobuf message never starts with a byte below 0x08,
+// which would be a tag for the invalid field number 0. Those bytes are free to mark a blob as
+// encoded, so blobs stored before compression existed, with no header at all, still read as they are.
+type Codec byte
+
+const (
+	// CodecNone stores a blob as it is, without a header
+	CodecNone Codec = 0x00
+	// CodecSnappy is snappy's block format: fast, for blobs read on every login
+	CodecSnappy Codec = 0x01
+	// CodecZstd compresses tighter than snappy, for large blobs of repeated strings
+	CodecZstd Codec = 0x02
+	// CodecSealed is an envelope encrypted blob, whose plaintext may be compressed in turn
+	CodecSealed Codec = 0x03
+)
+
+// maxHeaderByte is the highest first byte no protobuf message can start with
+const maxHeaderByte = 0x07
+
+// maxDecodedBytes bounds how far a blob may expand, so a corrupt blob cannot exhaust memory
+const maxDecodedBytes = 64 << 20
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecodedBytes))
+)
+
+// compression holds the codec of each "table.column", and the size below which blobs are stored as they are,
+// set by SetCompression
+var compression = struct {
+	columns  map[string]Codec
+	minBytes int
+}{}
+
+// ParseCodec reads a codec by its config name: none, snappy or zstd.
+func ParseCodec(name string) (Codec, error) {
+	switch name {
+	case "none", "":
+		return CodecNone, nil
+	case "snappy":
+		return CodecSnappy, nil
+	case "zstd":
+		return CodecZstd, nil
+	}
+	return CodecNone, fmt.Errorf("unknown compression codec %q", name)
+}
+
+// String returns the codec's config name.
+func (c Codec) String() string {
+	switch c {
+	case CodecNone:
+		return "none"
+	case CodecSnappy:
+		return "snappy"
+	case CodecZstd:
+		return "zstd"
+	case CodecSealed:
+		return "sealed"
+	}
+	return fmt.Sprintf("codec(%#02x)", byte(c))
+}
+
+// SetCompression sets the codec SaveData compresses each column with. Blobs are decompressed by the codec
+// in their header whatever is set, so a column's codec can be changed or removed at any time.
+func SetCompression(cfg config.Compression) error {
+	columns := make(map[string]Codec, len(cfg.Columns))
+	for column, name := range cfg.Columns {
+		codec, err := ParseCodec(name)
+		if err != nil {
+			return fmt.Errorf("compression.columns.%s: %w", column, err)
+		}
+		columns[column] = codec
+	}
+	compression.columns, compression.minBytes = columns, cfg.MinBytes
+	return nil
+}
+
+// encodeBlob compresses a blob saved to table.column with the column's codec, then seals it to its row's
+// primary key if the column is encrypted.
+func encodeBlob(table, column string, rowKey map[string]string, data []byte) ([]byte, error) {
+	data = compressBlob(table, column, data)
+	if !encryption.columns[table+"."+column] {
+		return data, nil
+	}
+	return sealBlob(table, column, rowKey, data)
+}
+
+// decodeBlob opens a blob loaded from table.column in the row with the given primary key if it is sealed,
+// then decompresses it.
+func decodeBlob(table, column string, rowKey map[string]string, data []byte) ([]byte, error) {
+	if len(data) > 0 && Codec(data[0]) == CodecSealed {
+		var err error
+		if data, err = openBlob(table, column, rowKey, data); err != nil {
+			return nil, err
+		}
+	}
+	return decompressBlob(table, column, data)
+}
+
+// compressBlob encodes a blob saved to table.column with the column's codec. Blobs too small to be worth it,
+// and blobs that would not shrink, are stored as they are.
+func compressBlob(table, column string, data []byte) []byte {
+	codec := compression.columns[table+"."+column]
+	if codec == CodecNone || len(data) < compression.minBytes {
+		return data
+	}
+
+	var compressed []byte
+	switch codec {
+	case CodecSnappy:
+		buf := make([]byte, 1+snappy.MaxEncodedLen(len(data)))
+		compressed = buf[:1+len(snappy.Encode(buf[1:], data))]
+	case CodecZstd:
+		compressed = zstdEncoder.EncodeAll(data, make([]byte, 1, 1+len(data)))
+	}
+	if len(compressed) >= len(data) {
+		return data
+	}
+	compressed[0] = byte(codec)
+	metrics.CompressionRatio.WithLabelValues(table, column, codec.String()).
+		Observe(float64(len(compressed)) / float64(len(data)))
+	return compressed
+}
+
+// decompressBlob decodes a blob loaded from Scylla by the codec in its header. Blobs without one are returned as they are.
+func decompressBlob(table, column string, data []byte) ([]byte, error) {
+	if len(data) == 0 || data[0] > maxHeaderByte {
+		return data, nil
+	}
+
+	var decoded []byte
+	var err error
+	switch Codec(data[0]) {
+	case CodecSnappy:
+		var n int
+		if n, err = snappy.DecodedLen(data[1:]); err == nil && n > maxDecodedBytes {
+			err = fmt.Errorf("blob would expand to %d bytes", n)
+		}
+		if err == nil {
+			decoded, err = snappy.Decode(nil, data[1:])
+		}
+	case CodecZstd:
+		decoded, err = zstdDecoder.DecodeAll(data[1:], nil)
+	default:
+		err = fmt.Errorf("unknown blob header %#02x", data[0])
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress %s.%s: %w", table, column, err)
+	}
+	return decoded, nil
+}
@@ -0,0 +1,147 @@
+package db
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Runic-Studios/Trove/server/internal/config"
+	"github.com/golang/snappy"
+)
+
+func setCompression(t *testing.T, cfg config.Compression) {
+	t.Helper()
+	saved := compression
+	t.Cleanup(func() { compression = saved })
+	if err := SetCompression(cfg); err != nil {
+		t.Fatalf("SetCompression() error = %v", err)
+	}
+}
+
+func TestCompressBlob(t *testing.T) {
+	setCompression(t, config.Compression{
+		Columns: map[string]string{
+			"players.bank":      "snappy",
+			"players.settings":  "zstd",
+			"characters.traits": "none",
+		},
+		MinBytes: 64,
+	})
+	// a protobuf message always starts with a byte above maxHeaderByte
+	repeated := append([]byte{0x0a}, bytes.Repeat([]byte("runic sword of the north "), 40)...)
+	small := []byte{0x0a, 0x03, 'a', 'b', 'c'}
+	random := []byte{0x0a}
+	for i := 0; i < 256; i++ {
+		random = append(random, byte(i*167+13))
+	}
+
+	tests := []struct {
+		name       string
+		table      string
+		column     string
+		data       []byte
+		wantHeader Codec
+	}{
+		{"snappy", "players", "bank", repeated, CodecSnappy},
+		{"zstd", "players", "settings", repeated, CodecZstd},
+		{"codec none", "characters", "traits", repeated, CodecNone},
+		{"column without a codec", "players", "friends", repeated, CodecNone},
+		{"below min bytes", "players", "bank", small, CodecNone},
+		{"would not shrink", "players", "settings", random, CodecNone},
+		{"empty", "players", "bank", nil, CodecNone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded := compressBlob(tt.table, tt.column, tt.data)
+			if tt.wantHeader == CodecNone {
+				if !bytes.Equal(encoded, tt.data) {
+					t.Fatalf("compressBlob() = %x, want the blob as it is", encoded)
+				}
+			} else {
+				if Codec(encoded[0]) != tt.wantHeader {
+					t.Fatalf("compressBlob() header = %s, want %s", Codec(encoded[0]), tt.wantHeader)
+				}
+				if len(encoded) >= len(tt.data) {
+					t.Errorf("compressBlob() is %d bytes, want fewer than %d", len(encoded), len(tt.data))
+				}
+			}
+
+			decoded, err := decompressBlob(tt.table, tt.column, encoded)
+			if err != nil {
+				t.Fatalf("decompressBlob() error = %v", err)
+			}
+			if !bytes.Equal(decoded, tt.data) {
+				t.Errorf("decompressBlob() = %x, want %x", decoded, tt.data)
+			}
+		})
+	}
+}
+
+func TestDecompressBlob(t *testing.T) {
+	legacy := []byte{0x0a, 0x05, 's', 'w', 'o', 'r', 'd'}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []byte
+		wantErr string
+	}{
+		{
+			name: "blob without a header",
+			data: legacy,
+			want: legacy,
+		},
+		{
+			name: "snappy",
+			data: append([]byte{byte(CodecSnappy)}, snappy.Encode(nil, legacy)...),
+			want: legacy,
+		},
+		{
+			name: "zstd",
+			data: zstdEncoder.EncodeAll(legacy, []byte{byte(CodecZstd)}),
+			want: legacy,
+		},
+		{
+			name:    "corrupt snappy",
+			data:    []byte{byte(CodecSnappy), 0xff, 0xff},
+			wantErr: "failed to decompress players.bank",
+		},
+		{
+			name:    "corrupt zstd",
+			data:    []byte{byte(CodecZstd), 0x01, 0x02, 0x03},
+			wantErr: "failed to decompress players.bank",
+		},
+		{
+			name:    "unknown header",
+			data:    []byte{0x07, 0x01},
+			wantErr: "unknown blob header 0x07",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decompressBlob("players", "bank", tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decompressBlob() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decompressBlob() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("decompressBlob() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetCompressionUnknownCodec(t *testing.T) {
+	setCompression(t, config.Compression{})
+	err := SetCompression(config.Compression{Columns: map[string]string{"players.bank": "lz4"}})
+	if err == nil || !strings.Contains(err.Error(), `compression.columns.players.bank: unknown compression codec "lz4"`) {
+		t.Fatalf("SetCompression() error = %v, want the column and codec named", err)
+	}
+}
@@ -0,0 +1,314 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Runic-Studios/Trove/server/internal/config"
+	"github.com/Runic-Studios/Trove/server/internal/logging"
+	"github.com/gocql/gocql"
+	"gopkg.in/yaml.v3"
+)
+
+// === ENCRYPTION AT REST ===
+
+// Sealed blobs are envelope encrypted: each blob is encrypted with AES-256-GCM under a fresh data key,
+// and the data key is itself encrypted under a key from the keyring, named in the blob's header:
+//
+//	0x03 | key id length | key id | nonce | wrapped data key | nonce | ciphertext
+//
+// Both are authenticated against the header, the blob's "table.column" and the primary key of its row,
+// so a blob cannot be moved to another column or another player's row, or have its key id swapped,
+// without failing to decrypt.
+const (
+	dataKeySize        = 32
+	nonceSize          = 12
+	tagSize            = 16
+	wrappedDataKeySize = nonceSize + dataKeySize + tagSize
+)
+
+// keyring holds the key-encryption keys by id, and the id of the primary key new blobs are sealed with
+type keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// keyringFile is the YAML layout of the keyring file: base64 AES-256 keys by id, and the primary key id.
+//
+//	primary: 2024-10
+//	keys:
+//	  2024-04: 3q2+7w...
+//	  2024-10: yv66vg...
+type keyringFile struct {
+	Primary string            `yaml:"primary"`
+	Keys    map[string]string `yaml:"keys"`
+}
+
+// encryption holds the "table.column"s sealed at rest and the keyring, set by SetEncryption
+var encryption = struct {
+	columns map[string]bool
+	keyring *keyring
+}{}
+
+// SetEncryption loads the keyring and sets the columns SaveData seals. Blobs are opened by the key in
+// their header whatever is set, as long as that key is still in the keyring.
+func SetEncryption(cfg config.Encryption) error {
+	if cfg.KeyringFile == "" {
+		if len(cfg.Columns) > 0 {
+			return errors.New("encrypted columns need a keyring file")
+		}
+		encryption.columns, encryption.keyring = nil, nil
+		return nil
+	}
+	ring, err := loadKeyring(cfg.KeyringFile)
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]bool, len(cfg.Columns))
+	for _, column := range cfg.Columns {
+		columns[column] = true
+	}
+	encryption.columns, encryption.keyring = columns, ring
+	return nil
+}
+
+// loadKeyring reads and checks a keyring file.
+func loadKeyring(path string) (*keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+	var file keyringFile
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring %s: %w", path, err)
+	}
+
+	ring := &keyring{primary: file.Primary, keys: make(map[string]cipher.AEAD, len(file.Keys))}
+	for id, encoded := range file.Keys {
+		if id == "" || len(id) > 255 {
+			return nil, fmt.Errorf("keyring key id %q must be between 1 and 255 bytes", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("keyring key %q must be 32 bytes, base64 encoded", id)
+		}
+		if ring.keys[id], err = newAEAD(key); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := ring.keys[ring.primary]; !ok {
+		return nil, fmt.Errorf("keyring primary key %q is not in its keys", ring.primary)
+	}
+	return ring, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealBlob encrypts a blob saved to table.column in the row with the given primary key under a fresh data key,
+// wrapped with the primary key.
+func sealBlob(table, column string, rowKey map[string]string, data []byte) ([]byte, error) {
+	ring := encryption.keyring
+	header := append([]byte{byte(CodecSealed), byte(len(ring.primary))}, ring.primary...)
+	aad := sealedAAD(header, table, column, rowKey)
+
+	dataKey := make([]byte, dataKeySize)
+	nonces := make([]byte, 2*nonceSize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(nonces); err != nil {
+		return nil, err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := make([]byte, 0, len(header)+wrappedDataKeySize+nonceSize+len(data)+tagSize)
+	sealed = append(sealed, header...)
+	sealed = append(sealed, nonces[:nonceSize]...)
+	sealed = ring.keys[ring.primary].Seal(sealed, nonces[:nonceSize], dataKey, aad)
+	sealed = append(sealed, nonces[nonceSize:]...)
+	return dataAEAD.Seal(sealed, nonces[nonceSize:], data, aad), nil
+}
+
+// openBlob decrypts a sealed blob loaded from table.column in the row with the given primary key,
+// with the key named in its header.
+func openBlob(table, column string, rowKey map[string]string, sealed []byte) ([]byte, error) {
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("failed to decrypt %s.%s: %s", table, column, fmt.Sprintf(format, args...))
+	}
+	keyID, ok := sealedKeyID(sealed)
+	if !ok {
+		return nil, fail("blob is truncated")
+	}
+	header := sealed[:2+len(keyID)]
+	body := sealed[len(header):]
+	if len(body) < wrappedDataKeySize+nonceSize+tagSize {
+		return nil, fail("blob is truncated")
+	}
+	if encryption.keyring == nil {
+		return nil, fail("blob is sealed with key %q but no keyring is configured", keyID)
+	}
+	keyAEAD, ok := encryption.keyring.keys[keyID]
+	if !ok {
+		return nil, fail("blob is sealed with key %q, which is not in the keyring", keyID)
+	}
+	aad := sealedAAD(header, table, column, rowKey)
+
+	dataKey, err := keyAEAD.Open(nil, body[:nonceSize], body[nonceSize:wrappedDataKeySize], aad)
+	if err != nil {
+		return nil, fail("data key does not authenticate with key %q", keyID)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, fail("%v", err)
+	}
+	body = body[wrappedDataKeySize:]
+	data, err := dataAEAD.Open(nil, body[:nonceSize], body[nonceSize:], aad)
+	if err != nil {
+		return nil, fail("blob does not authenticate")
+	}
+	return data, nil
+}
+
+// sealedAAD returns the data both layers of a sealed blob are authenticated against: its header,
+// "table.column" and the formatted primary key of its row.
+func sealedAAD(header []byte, table, column string, rowKey map[string]string) []byte {
+	aad := append(append([]byte{}, header...), table+"."+column...)
+	return append(append(aad, 0), formatRowKey(rowKey)...)
+}
+
+// formatRowKey renders a primary key as "k1=v1, k2=v2" in key order. Values are canonicalized, so that
+// a key given by a client as text and the same key read back from Scylla format the same way.
+func formatRowKey(rowKey map[string]string) string {
+	parts := make([]string, 0, len(rowKey))
+	for k, v := range rowKey {
+		if uuid, err := gocql.ParseUUID(v); err == nil {
+			v = uuid.String()
+		} else if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			v = strconv.FormatInt(n, 10)
+		}
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// sealedKeyID returns the id of the key a sealed blob was sealed with.
+func sealedKeyID(sealed []byte) (string, bool) {
+	if len(sealed) < 2 || Codec(sealed[0]) != CodecSealed || len(sealed) < 2+int(sealed[1]) {
+		return "", false
+	}
+	return string(sealed[2 : 2+int(sealed[1])]), true
+}
+
+// ReencryptRange re-seals with the primary key every blob of column, in rows whose partition token falls
+// in the given range, that is sealed with an older key or stored in plaintext, and returns how many it rewrote.
+// Each blob is rewritten with a write timestamp just after the one it was stored with, so a Save made
+// since it was read still wins over the rewrite.
+func ReencryptRange(
+	ctx context.Context,
+	session *gocql.Session,
+	table string,
+	schema TableSchema,
+	column string,
+	tokenRange TokenRange,
+	pageSize int,
+) (int64, error) {
+	if !isSafeIdentifier(table) {
+		return 0, invalidRequest("invalid table name: %s", table)
+	}
+	if !isSafeIdentifier(column) {
+		return 0, invalidRequest("invalid column name: %s", column)
+	}
+	if encryption.keyring == nil || !encryption.columns[table+"."+column] {
+		return 0, invalidRequest("column %s.%s is not encrypted", table, column)
+	}
+
+	keys := schema.PrimaryKeys()
+	partitionKeys := strings.Join(schema.PartitionKeys, ", ")
+	queryStr := fmt.Sprintf(
+		"SELECT %s, %s, WRITETIME(%s) AS written_at FROM %s WHERE token(%s) > ? AND token(%s) <= ?",
+		strings.Join(keys, ", "), column, column, table, partitionKeys, partitionKeys,
+	)
+	whereKeys := make([]string, len(keys))
+	for i, key := range keys {
+		whereKeys[i] = key + " = ?"
+	}
+	updateStr := fmt.Sprintf("UPDATE %s USING TIMESTAMP ? SET %s = ? WHERE %s", table, column, strings.Join(whereKeys, " AND "))
+
+	iter := readQuery(ctx, session, queryStr, tokenRange.Start, tokenRange.End).PageSize(pageSize).Iter()
+	var rewritten int64
+	for {
+		values := make(map[string]interface{}, len(keys)+2)
+		if !iter.MapScan(values) {
+			break
+		}
+		blob, _ := values[column].([]byte)
+		if len(blob) == 0 {
+			continue
+		}
+		if keyID, ok := sealedKeyID(blob); ok && keyID == encryption.keyring.primary {
+			continue
+		}
+
+		rowKey := make(map[string]string, len(keys))
+		for _, key := range keys {
+			rowKey[key] = fmt.Sprint(values[key])
+		}
+		data := blob
+		if Codec(blob[0]) == CodecSealed {
+			var err error
+			if data, err = openBlob(table, column, rowKey, blob); err != nil {
+				_ = iter.Close()
+				return rewritten, err
+			}
+		}
+		resealed, err := sealBlob(table, column, rowKey, data)
+		if err != nil {
+			_ = iter.Close()
+			return rewritten, err
+		}
+		writtenAt, _ := values["written_at"].(int64)
+		args := append([]interface{}{writtenAt + 1, resealed}, keyValues(values, keys)...)
+		if err := writeQuery(ctx, session, updateStr, args...).Exec(); err != nil {
+			_ = iter.Close()
+			return rewritten, err
+		}
+		rewritten++
+	}
+
+	if err := iter.Close(); err != nil {
+		logging.FromContext(ctx).DebugContext(ctx, "query failed re-encrypting", slog.String("query", queryStr), slog.Any("error", err))
+		return rewritten, err
+	}
+	return rewritten, nil
+}
+
+func keyValues(values map[string]interface{}, keys []string) []interface{} {
+	args := make([]interface{}, len(keys))
+	for i, key := range keys {
+		args[i] = values[key]
+	}
+	return args
+}
@@ -0,0 +1,199 @@
+package db
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Runic-Studios/Trove/server/internal/config"
+)
+
+// setKeyring writes a keyring file of the given key ids, each key the SHA-256 of its id,
+// and loads it with primary as the primary key.
+func setKeyring(t *testing.T, primary string, ids ...string) {
+	t.Helper()
+	saved := encryption
+	t.Cleanup(func() { encryption = saved })
+
+	var file strings.Builder
+	file.WriteString("primary: " + primary + "\nkeys:\n")
+	for _, id := range ids {
+		key := sha256.Sum256([]byte(id))
+		file.WriteString("  " + id + ": " + base64.StdEncoding.EncodeToString(key[:]) + "\n")
+	}
+	path := filepath.Join(t.TempDir(), "keyring.yaml")
+	if err := os.WriteFile(path, []byte(file.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetEncryption(config.Encryption{KeyringFile: path, Columns: []string{"players.bank"}}); err != nil {
+		t.Fatalf("SetEncryption() error = %v", err)
+	}
+}
+
+func TestOpenBlob(t *testing.T) {
+	setKeyring(t, "2024-10", "2024-10")
+	rowKey := map[string]string{"user_id": "7f1c9a52-2d5e-4a8e-9c1b-3f2a6d8e4b10"}
+	data := []byte{0x0a, 0x05, 's', 'w', 'o', 'r', 'd'}
+	sealed, err := sealBlob("players", "bank", rowKey, data)
+	if err != nil {
+		t.Fatalf("sealBlob() error = %v", err)
+	}
+	tampered := append([]byte{}, sealed...)
+	tampered[len(tampered)-1] ^= 0xff
+	swappedKeyID := append([]byte{}, sealed...)
+	swappedKeyID[2] = 'X'
+
+	tests := []struct {
+		name    string
+		table   string
+		column  string
+		rowKey  map[string]string
+		sealed  []byte
+		wantErr string
+	}{
+		{
+			name:   "round trip",
+			table:  "players",
+			column: "bank",
+			rowKey: rowKey,
+			sealed: sealed,
+		},
+		{
+			name:   "row key in another form",
+			table:  "players",
+			column: "bank",
+			rowKey: map[string]string{"user_id": "7F1C9A52-2D5E-4A8E-9C1B-3F2A6D8E4B10"},
+			sealed: sealed,
+		},
+		{
+			name:    "another column",
+			table:   "players",
+			column:  "settings",
+			rowKey:  rowKey,
+			sealed:  sealed,
+			wantErr: "data key does not authenticate",
+		},
+		{
+			name:    "another row",
+			table:   "players",
+			column:  "bank",
+			rowKey:  map[string]string{"user_id": "0b4c7e1d-5a3f-4c2e-8d9a-1e6f2b7c3a40"},
+			sealed:  sealed,
+			wantErr: "data key does not authenticate",
+		},
+		{
+			name:    "tampered ciphertext",
+			table:   "players",
+			column:  "bank",
+			rowKey:  rowKey,
+			sealed:  tampered,
+			wantErr: "blob does not authenticate",
+		},
+		{
+			name:    "swapped key id",
+			table:   "players",
+			column:  "bank",
+			rowKey:  rowKey,
+			sealed:  swappedKeyID,
+			wantErr: `sealed with key "X024-10", which is not in the keyring`,
+		},
+		{
+			name:    "truncated",
+			table:   "players",
+			column:  "bank",
+			rowKey:  rowKey,
+			sealed:  sealed[:20],
+			wantErr: "blob is truncated",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := openBlob(tt.table, tt.column, tt.rowKey, tt.sealed)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("openBlob() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("openBlob() error = %v", err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("openBlob() = %x, want %x", got, data)
+			}
+		})
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	rowKey := map[string]string{"user_id": "7f1c9a52-2d5e-4a8e-9c1b-3f2a6d8e4b10"}
+	data := []byte{0x0a, 0x05, 's', 'w', 'o', 'r', 'd'}
+
+	setKeyring(t, "2024-04", "2024-04", "2024-10")
+	old, err := sealBlob("players", "bank", rowKey, data)
+	if err != nil {
+		t.Fatalf("sealBlob() error = %v", err)
+	}
+
+	// the same keys, with the newer one made primary
+	setKeyring(t, "2024-10", "2024-04", "2024-10")
+	if got, err := openBlob("players", "bank", rowKey, old); err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("openBlob() of a blob sealed with the old primary = %x, %v, want %x", got, err, data)
+	}
+	resealed, err := sealBlob("players", "bank", rowKey, data)
+	if err != nil {
+		t.Fatalf("sealBlob() error = %v", err)
+	}
+	if keyID, _ := sealedKeyID(resealed); keyID != "2024-10" {
+		t.Errorf("sealBlob() sealed with key %q, want the new primary 2024-10", keyID)
+	}
+
+	// the old key retired from the keyring
+	setKeyring(t, "2024-10", "2024-10")
+	if _, err := openBlob("players", "bank", rowKey, old); err == nil ||
+		!strings.Contains(err.Error(), `sealed with key "2024-04", which is not in the keyring`) {
+		t.Errorf("openBlob() with the old key retired error = %v, want the missing key named", err)
+	}
+	if got, err := openBlob("players", "bank", rowKey, resealed); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("openBlob() of a resealed blob = %x, %v, want %x", got, err, data)
+	}
+}
+
+func TestFormatRowKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		rowKey map[string]string
+		want   string
+	}{
+		{"empty", nil, ""},
+		{"single key", map[string]string{"user_id": "abc"}, "user_id=abc"},
+		{
+			name:   "keys in order",
+			rowKey: map[string]string{"user_id": "abc", "character_id": "3"},
+			want:   "character_id=3, user_id=abc",
+		},
+		{
+			name:   "uuid lowercased",
+			rowKey: map[string]string{"user_id": "7F1C9A52-2D5E-4A8E-9C1B-3F2A6D8E4B10"},
+			want:   "user_id=7f1c9a52-2d5e-4a8e-9c1b-3f2a6d8e4b10",
+		},
+		{
+			name:   "int canonicalized",
+			rowKey: map[string]string{"character_id": "+007"},
+			want:   "character_id=7",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := formatRowKey(tt.rowKey); got != tt.want {
+				t.Errorf("formatRowKey() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
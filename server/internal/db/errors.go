@@ -0,0 +1,46 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gocql/gocql"
+)
+
+// ErrInvalidRequest is matched by every error caused by a malformed request rather than by Scylla
+var ErrInvalidRequest = errors.New("invalid request")
+
+// invalidRequestError keeps its own message while matching ErrInvalidRequest
+type invalidRequestError struct {
+	msg string
+}
+
+func (e invalidRequestError) Error() string {
+	return e.msg
+}
+
+func (e invalidRequestError) Is(target error) bool {
+	return target == ErrInvalidRequest
+}
+
+func invalidRequest(format string, args ...interface{}) error {
+	return invalidRequestError{msg: fmt.Sprintf(format, args...)}
+}
+
+// IsUnavailable reports whether err means Scylla could not be reached or did not answer in time,
+// as opposed to rejecting the query, so the request may succeed if retried.
+func IsUnavailable(err error) bool {
+	switch {
+	case errors.Is(err, gocql.ErrNoConnections),
+		errors.Is(err, gocql.ErrNoConnectionsStarted),
+		errors.Is(err, gocql.ErrConnectionClosed),
+		errors.Is(err, gocql.ErrSessionClosed),
+		errors.Is(err, gocql.ErrTimeoutNoResponse),
+		errors.Is(err, gocql.ErrUnavailable):
+		return true
+	}
+	var unavailable *gocql.RequestErrUnavailable
+	var writeTimeout *gocql.RequestErrWriteTimeout
+	var readTimeout *gocql.RequestErrReadTimeout
+	return errors.As(err, &unavailable) || errors.As(err, &writeTimeout) || errors.As(err, &readTimeout)
+}
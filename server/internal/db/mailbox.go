@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// === MAILBOX ===
+
+// MailboxTable holds deliveries for players, who need not be online or locked by anyone when mail is sent:
+//
+//	CREATE TABLE mailbox (
+//	    user_id uuid,
+//	    mail_id timeuuid,
+//	    sender text,
+//	    payload blob,
+//	    sent_at timestamp,
+//	    delivered_to text,
+//	    delivered_at timestamp,
+//	    PRIMARY KEY ((user_id), mail_id)
+//	) WITH CLUSTERING ORDER BY (mail_id ASC);
+//
+// Mail is append only: delivered entries are marked rather than deleted.
+const MailboxTable = "mailbox"
+
+// Mail is a single delivery in a player's mailbox.
+type Mail struct {
+	UserID  string
+	MailID  gocql.UUID
+	Sender  string
+	Payload []byte
+	SentAt  time.Time
+}
+
+// SendMail appends a delivery to the player's mailbox and returns its id.
+func SendMail(ctx context.Context, session *gocql.Session, userID, sender string, payload []byte) (Mail, error) {
+	mail := Mail{
+		UserID:  userID,
+		MailID:  gocql.TimeUUID(),
+		Sender:  sender,
+		Payload: payload,
+		SentAt:  time.Now(),
+	}
+	const insertCQL = `
+		INSERT INTO mailbox (user_id, mail_id, sender, payload, sent_at)
+		VALUES (?, ?, ?, ?, ?);`
+	err := writeQuery(ctx, session, insertCQL, mail.UserID, mail.MailID, mail.Sender, mail.Payload, mail.SentAt).Exec()
+	return mail, err
+}
+
+// ListUndeliveredMail returns up to limit deliveries of the player that have not been claimed yet, oldest first.
+func ListUndeliveredMail(ctx context.Context, session *gocql.Session, userID string, limit int) ([]Mail, error) {
+	const selectCQL = `
+		SELECT mail_id, sender, payload, sent_at, delivered_to
+		FROM mailbox
+		WHERE user_id = ?;`
+	iter := readQuery(ctx, session, selectCQL, userID).Iter()
+
+	var results []Mail
+	for {
+		mail := Mail{UserID: userID}
+		var deliveredTo string
+		if !iter.Scan(&mail.MailID, &mail.Sender, &mail.Payload, &mail.SentAt, &deliveredTo) {
+			break
+		}
+		if deliveredTo != "" {
+			continue
+		}
+		results = append(results, mail)
+		if limit > 0 && len(results) >= limit {
+			break
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// MarkMailDelivered marks a delivery as claimed by serverID, unless it was already claimed.
+// It returns whether this call claimed it.
+func MarkMailDelivered(ctx context.Context, session *gocql.Session, userID string, mailID gocql.UUID, serverID string) (bool, error) {
+	const updateCQL = `
+		UPDATE mailbox
+		SET delivered_to = ?, delivered_at = ?
+		WHERE user_id = ? AND mail_id = ?
+		IF delivered_to = null;`
+	return lockQuery(ctx, session, updateCQL, serverID, time.Now(), userID, mailID).
+		MapScanCAS(make(map[string]interface{}))
+}
@@ -0,0 +1,297 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/internal/logging"
+	"github.com/gocql/gocql"
+)
+
+// === BACKGROUND MIGRATION ===
+
+// TableSchema describes the key and blob columns of a table, as discovered from system_schema.
+type TableSchema struct {
+	PartitionKeys  []string
+	ClusteringKeys []string
+	BlobColumns    []string
+}
+
+// PrimaryKeys returns the partition keys followed by the clustering keys.
+func (t TableSchema) PrimaryKeys() []string {
+	return append(append([]string{}, t.PartitionKeys...), t.ClusteringKeys...)
+}
+
+// LoadTableSchema reads the primary key and blob columns of a table in the session keyspace.
+func LoadTableSchema(ctx context.Context, session *gocql.Session, keyspace, table string) (TableSchema, error) {
+	if !isSafeIdentifier(table) {
+		return TableSchema{}, invalidRequest("invalid table name: %s", table)
+	}
+
+	const schemaCQL = `
+		SELECT column_name, kind, position, type
+		FROM system_schema.columns
+		WHERE keyspace_name = ? AND table_name = ?;`
+	iter := readQuery(ctx, session, schemaCQL, keyspace, table).Iter()
+
+	var schema TableSchema
+	partition := map[int]string{}
+	clustering := map[int]string{}
+	var name, kind, typ string
+	var position int
+	for iter.Scan(&name, &kind, &position, &typ) {
+		switch kind {
+		case "partition_key":
+			partition[position] = name
+		case "clustering":
+			clustering[position] = name
+		default:
+			if typ == "blob" {
+				schema.BlobColumns = append(schema.BlobColumns, name)
+			}
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return TableSchema{}, err
+	}
+	if len(partition) == 0 {
+		return TableSchema{}, invalidRequest("table %s.%s does not exist", keyspace, table)
+	}
+
+	for i := 0; i < len(partition); i++ {
+		schema.PartitionKeys = append(schema.PartitionKeys, partition[i])
+	}
+	for i := 0; i < len(clustering); i++ {
+		schema.ClusteringKeys = append(schema.ClusteringKeys, clustering[i])
+	}
+	return schema, nil
+}
+
+// TokenRange is a half-open slice (Start, End] of the Murmur3 token ring.
+type TokenRange struct {
+	Start int64
+	End   int64
+}
+
+// SplitTokenRing divides the full Murmur3 token ring into n contiguous ranges.
+func SplitTokenRing(n int) []TokenRange {
+	step := uint64(math.MaxUint64) / uint64(n)
+	ranges := make([]TokenRange, n)
+	start := int64(math.MinInt64)
+	for i := 0; i < n; i++ {
+		end := int64(uint64(start) + step)
+		if i == n-1 {
+			end = math.MaxInt64
+		}
+		ranges[i] = TokenRange{Start: start, End: end}
+		start = end
+	}
+	return ranges
+}
+
+// ScannedRow is a primary key together with the schema version of the row it identifies,
+// and the blob columns that were selected alongside it.
+type ScannedRow struct {
+	Keys          map[string]string
+	SchemaVersion string
+	Data          map[string][]byte
+}
+
+// ScanTokenRange pages through every row of table whose partition token falls in the given range,
+// selecting the primary key, schema_version and the given blob columns, and calls fn for each row.
+func ScanTokenRange(
+	ctx context.Context,
+	session *gocql.Session,
+	table string,
+	schema TableSchema,
+	columns []string,
+	tokenRange TokenRange,
+	pageSize int,
+	fn func(row ScannedRow) error,
+) error {
+	if !isSafeIdentifier(table) {
+		return invalidRequest("invalid table name: %s", table)
+	}
+	for _, col := range columns {
+		if !isSafeIdentifier(col) {
+			return invalidRequest("invalid column name: %s", col)
+		}
+	}
+
+	keys := schema.PrimaryKeys()
+	selectClause := strings.Join(append(append([]string{}, keys...), columns...), ", ") + ", schema_version"
+	queryStr := fmt.Sprintf(
+		"SELECT %s FROM %s WHERE token(%s) > ? AND token(%s) <= ?",
+		selectClause, table,
+		strings.Join(schema.PartitionKeys, ", "), strings.Join(schema.PartitionKeys, ", "),
+	)
+	iter := readQuery(ctx, session, queryStr, tokenRange.Start, tokenRange.End).PageSize(pageSize).Iter()
+
+	for {
+		values := make(map[string]interface{}, len(keys)+len(columns)+1)
+		if !iter.MapScan(values) {
+			break
+		}
+		row := ScannedRow{
+			Keys: make(map[string]string, len(keys)),
+			Data: make(map[string][]byte, len(columns)),
+		}
+		for _, key := range keys {
+			row.Keys[key] = fmt.Sprint(values[key])
+		}
+		for _, col := range columns {
+			data, _ := values[col].([]byte)
+			blob, err := decodeBlob(table, col, row.Keys, data)
+			if err != nil {
+				_ = iter.Close()
+				return err
+			}
+			row.Data[col] = blob
+		}
+		if version, ok := values["schema_version"].(string); ok {
+			row.SchemaVersion = version
+		}
+		if err := fn(row); err != nil {
+			_ = iter.Close()
+			return err
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		logging.FromContext(ctx).DebugContext(ctx, "query failed scanning", slog.String("query", queryStr), slog.Any("error", err))
+		return err
+	}
+	return nil
+}
+
+// MigrationCheckpoint records the progress of a background migration for a single table.
+// It is stored in the migration_checkpoints table:
+//
+//	CREATE TABLE migration_checkpoints (
+//	    table_name text PRIMARY KEY,
+//	    target_version text,
+//	    next_range int,
+//	    total_ranges int,
+//	    migrated bigint,
+//	    skipped bigint,
+//	    failed bigint,
+//	    updated_at timestamp
+//	);
+type MigrationCheckpoint struct {
+	Table         string
+	TargetVersion string
+	NextRange     int
+	TotalRanges   int
+	Migrated      int64
+	Skipped       int64
+	Failed        int64
+	UpdatedAt     time.Time
+}
+
+// LoadMigrationCheckpoint returns the stored checkpoint for table, or nil if none exists.
+func LoadMigrationCheckpoint(ctx context.Context, session *gocql.Session, table string) (*MigrationCheckpoint, error) {
+	const loadCQL = `
+		SELECT target_version, next_range, total_ranges, migrated, skipped, failed, updated_at
+		FROM migration_checkpoints
+		WHERE table_name = ?;`
+	cp := &MigrationCheckpoint{Table: table}
+	err := readQuery(ctx, session, loadCQL, table).Scan(
+		&cp.TargetVersion, &cp.NextRange, &cp.TotalRanges,
+		&cp.Migrated, &cp.Skipped, &cp.Failed, &cp.UpdatedAt,
+	)
+	if errors.Is(err, gocql.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+// SaveMigrationCheckpoint upserts the checkpoint for its table.
+func SaveMigrationCheckpoint(ctx context.Context, session *gocql.Session, cp *MigrationCheckpoint) error {
+	const saveCQL = `
+		INSERT INTO migration_checkpoints
+		    (table_name, target_version, next_range, total_ranges, migrated, skipped, failed, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?);`
+	return writeQuery(ctx, session, saveCQL,
+		cp.Table, cp.TargetVersion, cp.NextRange, cp.TotalRanges,
+		cp.Migrated, cp.Skipped, cp.Failed, cp.UpdatedAt,
+	).Exec()
+}
+
+// AddMigrationPending records a row of table that was locked by a game server when the migration
+// scanned it, to be retried once every range has been scanned. Each row is kept once, however often
+// it is skipped. Pending rows are stored in the migration_pending table rather than the checkpoint,
+// so that a busy table does not grow the checkpoint without bound:
+//
+//	CREATE TABLE migration_pending (
+//	    table_name text,
+//	    row_key text,
+//	    super_keys map<text, text>,
+//	    PRIMARY KEY (table_name, row_key)
+//	);
+func AddMigrationPending(ctx context.Context, session *gocql.Session, table string, keys map[string]string) error {
+	const insertCQL = `INSERT INTO migration_pending (table_name, row_key, super_keys) VALUES (?, ?, ?);`
+	return writeQuery(ctx, session, insertCQL, table, formatRowKey(keys), keys).Exec()
+}
+
+// ScanMigrationPending calls fn with the primary key of every pending row of table, fetching pageSize rows at a time.
+// Rows may be removed with DeleteMigrationPending while scanning.
+func ScanMigrationPending(
+	ctx context.Context,
+	session *gocql.Session,
+	table string,
+	pageSize int,
+	fn func(keys map[string]string) error,
+) error {
+	const scanCQL = `SELECT super_keys FROM migration_pending WHERE table_name = ?;`
+	iter := readQuery(ctx, session, scanCQL, table).PageSize(pageSize).Iter()
+	var keys map[string]string
+	for iter.Scan(&keys) {
+		if err := fn(keys); err != nil {
+			_ = iter.Close()
+			return err
+		}
+		keys = nil
+	}
+	return iter.Close()
+}
+
+// DeleteMigrationPending removes a pending row once it has been migrated.
+func DeleteMigrationPending(ctx context.Context, session *gocql.Session, table string, keys map[string]string) error {
+	const deleteCQL = `DELETE FROM migration_pending WHERE table_name = ? AND row_key = ?;`
+	return writeQuery(ctx, session, deleteCQL, table, formatRowKey(keys)).Exec()
+}
+
+// ClearMigrationPending removes every pending row of table, when its migration is restarted.
+func ClearMigrationPending(ctx context.Context, session *gocql.Session, table string) error {
+	const deleteCQL = `DELETE FROM migration_pending WHERE table_name = ?;`
+	return writeQuery(ctx, session, deleteCQL, table).Exec()
+}
+
+// CountVersions scans the whole table and returns the number of rows at each schema version.
+func CountVersions(ctx context.Context, session *gocql.Session, table string, pageSize int) (map[string]int64, error) {
+	if !isSafeIdentifier(table) {
+		return nil, invalidRequest("invalid table name: %s", table)
+	}
+
+	queryStr := fmt.Sprintf("SELECT schema_version FROM %s", table)
+	iter := readQuery(ctx, session, queryStr).PageSize(pageSize).Iter()
+
+	counts := make(map[string]int64)
+	var version string
+	for iter.Scan(&version) {
+		counts[version]++
+	}
+	if err := iter.Close(); err != nil {
+		logging.FromContext(ctx).DebugContext(ctx, "query failed counting", slog.String("query", queryStr), slog.Any("error", err))
+		return nil, err
+	}
+	return counts, nil
+}
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSplitTokenRing(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+	}{
+		{"whole ring", 1},
+		{"halves", 2},
+		{"odd split", 3},
+		{"migration ranges", 256},
+		{"many ranges", 10_000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ranges := SplitTokenRing(tt.n)
+			if len(ranges) != tt.n {
+				t.Fatalf("got %d ranges, want %d", len(ranges), tt.n)
+			}
+			if ranges[0].Start != math.MinInt64 {
+				t.Errorf("first range starts at %d, want %d", ranges[0].Start, int64(math.MinInt64))
+			}
+			if last := ranges[len(ranges)-1]; last.End != math.MaxInt64 {
+				t.Errorf("last range ends at %d, want %d", last.End, int64(math.MaxInt64))
+			}
+
+			step := uint64(math.MaxUint64) / uint64(tt.n)
+			for i, r := range ranges {
+				if r.Start >= r.End {
+					t.Fatalf("range %d = (%d, %d] is empty", i, r.Start, r.End)
+				}
+				if i > 0 && ranges[i-1].End != r.Start {
+					t.Fatalf("range %d starts at %d, want the end of range %d, %d", i, r.Start, i-1, ranges[i-1].End)
+				}
+				// every range but the last, which takes the remainder, is one step wide
+				if size := uint64(r.End) - uint64(r.Start); i < len(ranges)-1 && size != step {
+					t.Errorf("range %d is %d tokens wide, want %d", i, size, step)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package db
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// === QUARANTINE ===
+
+// QuarantinedRow is a column whose blob failed to transform, kept with its original data
+// so it can be inspected and retried. RowKey and SuperKeys are the whole primary key of its row. It is stored in the quarantined_rows table:
+//
+//	CREATE TABLE quarantined_rows (
+//	    table_name text,
+//	    row_key text,
+//	    column_name text,
+//	    super_keys map<text, text>,
+//	    schema_version text,
+//	    version_path list<text>,
+//	    original blob,
+//	    error text,
+//	    quarantined_at timestamp,
+//	    PRIMARY KEY ((table_name), row_key, column_name)
+//	);
+type QuarantinedRow struct {
+	Table         string
+	RowKey        string
+	Column        string
+	SuperKeys     map[string]string
+	SchemaVersion string
+	VersionPath   []string
+	Original      []byte
+	Error         string
+	QuarantinedAt time.Time
+}
+
+// QuarantineRow inserts a quarantined column, unless it is already quarantined, and returns whether this call
+// inserted it. An existing entry keeps its original blob and the time it was first quarantined.
+// The original blob is compressed and sealed like the column's own, to the primary key in q.SuperKeys.
+func QuarantineRow(ctx context.Context, session *gocql.Session, q QuarantinedRow) (bool, error) {
+	original, err := encodeBlob(q.Table, q.Column, q.SuperKeys, q.Original)
+	if err != nil {
+		return false, err
+	}
+	const insertCQL = `
+		INSERT INTO quarantined_rows
+		    (table_name, row_key, column_name, super_keys, schema_version, version_path, original, error, quarantined_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+		IF NOT EXISTS;`
+	return lockQuery(ctx, session, insertCQL,
+		q.Table, q.RowKey, q.Column, q.SuperKeys, q.SchemaVersion, q.VersionPath, original, q.Error, q.QuarantinedAt,
+	).MapScanCAS(make(map[string]interface{}))
+}
+
+// ListQuarantined returns up to limit quarantined columns of table, optionally restricted to one row.
+func ListQuarantined(ctx context.Context, session *gocql.Session, table, rowKey string, limit int) ([]QuarantinedRow, error) {
+	queryStr := `
+		SELECT row_key, column_name, super_keys, schema_version, version_path, original, error, quarantined_at
+		FROM quarantined_rows
+		WHERE table_name = ?`
+	args := []interface{}{table}
+	if rowKey != "" {
+		queryStr += " AND row_key = ?"
+		args = append(args, rowKey)
+	}
+	if limit > 0 {
+		queryStr += " LIMIT ?"
+		args = append(args, limit)
+	}
+	iter := readQuery(ctx, session, queryStr, args...).Iter()
+
+	var results []QuarantinedRow
+	for {
+		q := QuarantinedRow{Table: table}
+		if !iter.Scan(
+			&q.RowKey, &q.Column, &q.SuperKeys, &q.SchemaVersion,
+			&q.VersionPath, &q.Original, &q.Error, &q.QuarantinedAt,
+		) {
+			break
+		}
+		original, err := decodeBlob(table, q.Column, q.SuperKeys, q.Original)
+		if err != nil {
+			_ = iter.Close()
+			return nil, err
+		}
+		q.Original = original
+		results = append(results, q)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// DeleteQuarantined removes a quarantined column once it has been resolved.
+func DeleteQuarantined(ctx context.Context, session *gocql.Session, table, rowKey, column string) error {
+	const deleteCQL = `DELETE FROM quarantined_rows WHERE table_name = ? AND row_key = ? AND column_name = ?;`
+	return writeQuery(ctx, session, deleteCQL, table, rowKey, column).Exec()
+}
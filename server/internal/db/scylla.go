@@ -1,57 +1,148 @@
 package db
 
 import (
+	"context"
 	"encoding/binary"
-	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"math"
-	"os"
+	"reflect"
 	"regexp"
-	"runtime/debug"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/Runic-Studios/Trove/server/internal/config"
+	"github.com/Runic-Studios/Trove/server/internal/logging"
+	"github.com/Runic-Studios/Trove/server/internal/metrics"
 	"github.com/gocql/gocql"
 )
 
-// NewSession Creates a new scylladb connection using env vars as connection settings
-func NewSession() (*gocql.Session, error) {
-	hosts := os.Getenv("SCYLLA_HOSTS") // e.g. "127.0.0.1"
-	if hosts == "" {
-		hosts = "127.0.0.1"
-		fmt.Printf("Warning: SCYLLA_HOSTS environment variable not set, defaulting to %s\n", hosts)
+// keyspace is the keyspace the session was created against, set by NewSession
+var keyspace = "trove"
+
+// consistency holds the consistency levels of reads, writes and lock LWTs, set by NewSession
+var consistency = struct {
+	read, write, lock gocql.Consistency
+	serial            gocql.SerialConsistency
+}{gocql.Quorum, gocql.Quorum, gocql.Quorum, gocql.Serial}
+
+// speculative re-sends slow idempotent queries to another host, set by NewSession if configured
+var speculative gocql.SpeculativeExecutionPolicy = gocql.NonSpeculativeExecution{}
+
+// NewSession Creates a new scylladb connection from the cluster config,
+// reporting every query attempt to observer
+func NewSession(cfg config.Cluster, observer gocql.QueryObserver) (*gocql.Session, error) {
+	read, err := gocql.ParseConsistencyWrapper(cfg.Consistency.Read)
+	if err != nil {
+		return nil, err
+	}
+	write, err := gocql.ParseConsistencyWrapper(cfg.Consistency.Write)
+	if err != nil {
+		return nil, err
 	}
-	keyspace := os.Getenv("SCYLLA_KEYSPACE") // e.g. "trove"
-	if keyspace == "" {
-		keyspace = "trove"
-		fmt.Printf("Warning: SCYLLA_KEYSPACE environment variable not set, defaulting to %s\n", keyspace)
+	lock, err := gocql.ParseConsistencyWrapper(cfg.Consistency.Lock)
+	if err != nil {
+		return nil, err
 	}
-	port, err := strconv.Atoi(os.Getenv("SCYLLA_PORT"))
-	if err != nil || port <= 0 {
-		port = 9042
-		fmt.Printf("Warning: SCYLLA_PORT environment variable not set, defaulting to %s\n", port)
+	serial := gocql.Serial
+	if strings.EqualFold(cfg.Consistency.Serial, "LOCAL_SERIAL") {
+		serial = gocql.LocalSerial
 	}
 
-	cluster := gocql.NewCluster(hosts)
-	cluster.Keyspace = keyspace
-	cluster.Consistency = gocql.Quorum
-	cluster.Port = port
+	cluster := gocql.NewCluster(cfg.Hosts...)
+	cluster.Keyspace = cfg.Keyspace
+	cluster.Consistency = write
+	cluster.SerialConsistency = serial
+	cluster.Port = cfg.Port
+	cluster.Timeout = cfg.Timeout
+	cluster.ConnectTimeout = cfg.ConnectTimeout
+	if cfg.Username != "" {
+		cluster.Authenticator = gocql.PasswordAuthenticator{Username: cfg.Username, Password: cfg.Password}
+	}
+	if cfg.TLS.Enabled {
+		cluster.SslOpts = &gocql.SslOptions{
+			CaPath:                 cfg.TLS.CAFile,
+			CertPath:               cfg.TLS.CertFile,
+			KeyPath:                cfg.TLS.KeyFile,
+			EnableHostVerification: cfg.TLS.VerifyHost,
+		}
+	}
+	policy := gocql.RoundRobinHostPolicy()
+	if cfg.LocalDC != "" {
+		policy = gocql.DCAwareRoundRobinPolicy(cfg.LocalDC)
+	}
+	if cfg.TokenAware {
+		policy = gocql.TokenAwareHostPolicy(policy, gocql.ShuffleReplicas())
+	}
+	cluster.PoolConfig.HostSelectionPolicy = policy
+	cluster.NumConns = cfg.ConnectionsPerHost
+	cluster.RetryPolicy = &gocql.ExponentialBackoffRetryPolicy{
+		NumRetries: cfg.Retry.MaxRetries,
+		Min:        cfg.Retry.MinBackoff,
+		Max:        cfg.Retry.MaxBackoff,
+	}
+	if cfg.SpeculativeExecution.Attempts > 0 {
+		speculative = &gocql.SimpleSpeculativeExecution{
+			NumAttempts:  cfg.SpeculativeExecution.Attempts,
+			TimeoutDelay: cfg.SpeculativeExecution.Delay,
+		}
+	}
+	cluster.QueryObserver = observer
+
+	keyspace = cfg.Keyspace
+	consistency.read, consistency.write, consistency.lock, consistency.serial = read, write, lock, serial
 	return cluster.CreateSession()
 }
 
-func saveProto(session *gocql.Session, table string, whereClause string, args []interface{}, column string, message []byte, version string) error {
+// Keyspace returns the keyspace sessions are created against
+func Keyspace() string {
+	return keyspace
+}
+
+// readQuery prepares a query that only reads, at the read consistency.
+// Reads are idempotent, so they may be executed speculatively.
+func readQuery(ctx context.Context, session *gocql.Session, stmt string, values ...interface{}) *gocql.Query {
+	return session.Query(stmt, values...).WithContext(ctx).
+		Consistency(consistency.read).
+		Idempotent(true).
+		SetSpeculativeExecutionPolicy(speculative)
+}
+
+// writeQuery prepares a plain write, at the write consistency.
+// Every plain write sets fixed values, so it is idempotent and may be executed speculatively.
+func writeQuery(ctx context.Context, session *gocql.Session, stmt string, values ...interface{}) *gocql.Query {
+	return session.Query(stmt, values...).WithContext(ctx).
+		Consistency(consistency.write).
+		Idempotent(true).
+		SetSpeculativeExecutionPolicy(speculative)
+}
+
+// lockQuery prepares a lightweight transaction, at the lock and serial consistencies.
+// A re-sent LWT could see its own first attempt as a conflict, so it is never executed speculatively.
+func lockQuery(ctx context.Context, session *gocql.Session, stmt string, values ...interface{}) *gocql.Query {
+	return session.Query(stmt, values...).WithContext(ctx).
+		Consistency(consistency.lock).
+		SerialConsistency(consistency.serial)
+}
+
+// Ping runs a trivial query to check that Scylla can be reached through the session
+func Ping(ctx context.Context, session *gocql.Session) error {
+	var now gocql.UUID
+	return session.Query(`SELECT now() FROM system.local`).WithContext(ctx).Scan(&now)
+}
+
+func saveProto(ctx context.Context, session *gocql.Session, table string, whereClause string, args []interface{}, column string, message []byte, version string) error {
 	queryStr := fmt.Sprintf("UPDATE %s SET %s = ?, schema_version = ? WHERE %s", table, column, whereClause)
 	allArgs := append([]interface{}{message, version}, args...)
-	return session.Query(queryStr, allArgs...).Exec()
+	return writeQuery(ctx, session, queryStr, allArgs...).Exec()
 }
 
-func loadProto(session *gocql.Session, table string, whereClause string, args []interface{}, column string) ([]byte, string, error) {
+func loadProto(ctx context.Context, session *gocql.Session, table string, whereClause string, args []interface{}, column string) ([]byte, string, error) {
 	queryStr := fmt.Sprintf("SELECT %s, schema_version FROM %s WHERE %s LIMIT 1", column, table, whereClause)
 	var data []byte
 	var version string
-	if err := session.Query(queryStr, args...).Scan(&data, &version); err != nil {
+	if err := readQuery(ctx, session, queryStr, args...).Scan(&data, &version); err != nil {
 		return nil, "", err
 	}
 	return data, version, nil
@@ -65,24 +156,24 @@ func isSafeIdentifier(s string) bool {
 	return identifierPattern.MatchString(s)
 }
 
-func SaveData(session *gocql.Session, table string, superkeys map[string]string, data map[string][]byte, version string) error {
+func SaveData(ctx context.Context, session *gocql.Session, table string, superkeys map[string]string, data map[string][]byte, version string) error {
 	if !isSafeIdentifier(table) {
-		return fmt.Errorf("invalid table name: %s", table)
+		return invalidRequest("invalid table name: %s", table)
 	}
 
 	if len(superkeys) == 0 {
-		return errors.New("must specify at least one superkey")
+		return invalidRequest("must specify at least one superkey")
 	}
 
 	if len(data) == 0 {
-		return errors.New("must specify at least one column")
+		return invalidRequest("must specify at least one column")
 	}
 
 	whereKeys := make([]string, 0, len(superkeys))
 	whereVals := make([]interface{}, 0, len(superkeys))
 	for key, val := range superkeys {
 		if !isSafeIdentifier(key) {
-			return fmt.Errorf("invalid key in superkeys: %s", key)
+			return invalidRequest("invalid key in superkeys: %s", key)
 		}
 		whereKeys = append(whereKeys, key+" = ?")
 		whereVals = append(whereVals, val)
@@ -93,10 +184,15 @@ func SaveData(session *gocql.Session, table string, superkeys map[string]string,
 	setVals := make([]interface{}, 0, len(data))
 	for key, val := range data {
 		if !isSafeIdentifier(key) {
-			return fmt.Errorf("invalid column name: %s", key)
+			return invalidRequest("invalid column name: %s", key)
 		}
 		setKeys = append(setKeys, key+" = ?")
-		setVals = append(setVals, val)
+		blob, err := encodeBlob(table, key, superkeys, val)
+		if err != nil {
+			return err
+		}
+		setVals = append(setVals, blob)
+		metrics.BlobSize.WithLabelValues(table, key, "save").Observe(float64(len(val)))
 	}
 	setClause := strings.Join(setKeys, ", ")
 
@@ -105,35 +201,54 @@ func SaveData(session *gocql.Session, table string, superkeys map[string]string,
 	allArgs := append(setVals, version)
 	allArgs = append(allArgs, whereVals...)
 
-	err := session.Query(queryStr, allArgs...).Exec()
+	err := writeQuery(ctx, session, queryStr, allArgs...).Exec()
 
 	if err != nil {
-		log.Printf("db internal error saving when executing %s\n%v\n%s", queryStr, err, debug.Stack())
+		logging.FromContext(ctx).DebugContext(ctx, "query failed saving", slog.String("query", queryStr), slog.Any("error", err))
 	}
 	return err
 }
 
+// primaryKeyColumns returns the primary key columns of table, from the driver's schema metadata.
+func primaryKeyColumns(session *gocql.Session, table string) ([]string, error) {
+	meta, err := session.KeyspaceMetadata(keyspace)
+	if err != nil {
+		return nil, err
+	}
+	tableMeta, ok := meta.Tables[table]
+	if !ok {
+		return nil, invalidRequest("unknown table: %s", table)
+	}
+	var keys []string
+	for _, column := range append(append([]*gocql.ColumnMetadata{}, tableMeta.PartitionKey...), tableMeta.ClusteringColumns...) {
+		keys = append(keys, column.Name)
+	}
+	return keys, nil
+}
+
 type Row struct {
+	// Keys is the row's whole primary key, which may name more keys than the super keys it was loaded by
+	Keys          map[string]string
 	Data          map[string][]byte
 	SchemaVersion string
 }
 
-func LoadData(session *gocql.Session, table string, superkeys map[string]string, columns []string) ([]Row, error) {
+func LoadData(ctx context.Context, session *gocql.Session, table string, superkeys map[string]string, columns []string) ([]Row, error) {
 	if !isSafeIdentifier(table) {
-		return nil, fmt.Errorf("invalid table name: %s", table)
+		return nil, invalidRequest("invalid table name: %s", table)
 	}
 
 	if len(superkeys) == 0 {
-		return nil, errors.New("must specify at least one superkey")
+		return nil, invalidRequest("must specify at least one superkey")
 	}
 
 	if len(columns) == 0 {
-		return nil, errors.New("must specify at least one column to select")
+		return nil, invalidRequest("must specify at least one column to select")
 	}
 
 	for _, col := range columns {
 		if !isSafeIdentifier(col) {
-			return nil, fmt.Errorf("invalid column name: %s", col)
+			return nil, invalidRequest("invalid column name: %s", col)
 		}
 	}
 
@@ -141,17 +256,31 @@ func LoadData(session *gocql.Session, table string, superkeys map[string]string,
 	whereVals := make([]interface{}, 0, len(superkeys))
 	for key, val := range superkeys {
 		if !isSafeIdentifier(key) {
-			return nil, fmt.Errorf("invalid superkey name: %s", key)
+			return nil, invalidRequest("invalid superkey name: %s", key)
 		}
 		whereKeys = append(whereKeys, key+" = ?")
 		whereVals = append(whereVals, val)
 	}
 	whereClause := strings.Join(whereKeys, " AND ")
 
-	selectClause := strings.Join(columns, ", ") + ", schema_version"
+	// sealed blobs are opened against their row's whole primary key, so select the key columns
+	// the super keys leave out, such as the slot of every character of a player. This is done whatever
+	// columns are encrypted now, since a column dropped from encryption.columns keeps its sealed blobs.
+	primaryKeys, err := primaryKeyColumns(session, table)
+	if err != nil {
+		return nil, err
+	}
+	var extraKeys []string
+	for _, key := range primaryKeys {
+		if !slices.Contains(columns, key) {
+			extraKeys = append(extraKeys, key)
+		}
+	}
+
+	selectClause := strings.Join(append(append(append([]string{}, columns...), "schema_version"), extraKeys...), ", ")
 	queryStr := fmt.Sprintf("SELECT %s FROM %s WHERE %s", selectClause, table, whereClause)
 
-	iter := session.Query(queryStr, whereVals...).Iter()
+	iter := readQuery(ctx, session, queryStr, whereVals...).Iter()
 
 	colInfos := iter.Columns()
 
@@ -178,27 +307,42 @@ func LoadData(session *gocql.Session, table string, superkeys map[string]string,
 			break
 		}
 
+		rowKey := make(map[string]string, len(primaryKeys))
+		for i, ci := range colInfos {
+			if slices.Contains(primaryKeys, ci.Name) {
+				rowKey[ci.Name] = fmt.Sprint(reflect.ValueOf(holders[i]).Elem().Interface())
+			}
+		}
+
 		// build Row from holders
 		data := make(map[string][]byte, len(columns))
 		var version string
 		for i, ci := range colInfos {
 			name := ci.Name
 			switch {
+			case i > len(columns):
+				// a key column selected only to open sealed blobs
 			case name == "schema_version":
 				version = *(holders[i].(*string))
 			case ci.TypeInfo.Type() == gocql.TypeBlob:
-				data[name] = *(holders[i].(*[]byte))
+				blob, err := decodeBlob(table, name, rowKey, *(holders[i].(*[]byte)))
+				if err != nil {
+					_ = iter.Close()
+					return nil, err
+				}
+				data[name] = blob
+				metrics.BlobSize.WithLabelValues(table, name, "load").Observe(float64(len(data[name])))
 			case ci.TypeInfo.Type() == gocql.TypeInt:
 				data[name] = toByteArray(*(holders[i].(*int32)))
 			default:
 				data[name] = toByteArray(*(holders[i].(*interface{})))
 			}
 		}
-		results = append(results, Row{Data: data, SchemaVersion: version})
+		results = append(results, Row{Keys: rowKey, Data: data, SchemaVersion: version})
 	}
 
 	if err := iter.Close(); err != nil {
-		log.Printf("db internal error loading when executing %s\n%v\n%s", queryStr, err, debug.Stack())
+		logging.FromContext(ctx).DebugContext(ctx, "query failed loading", slog.String("query", queryStr), slog.Any("error", err))
 		return nil, err
 	}
 
@@ -274,7 +418,7 @@ func toByteArray(val interface{}) []byte {
 
 // ClaimLock tries to INSERT, RENEW, or TAKEOVER a lock for the given player.
 // Returns (acquiredOrRenewed, expiresAt, error).
-func ClaimLock(session *gocql.Session, userID, serverID string, leaseMillis int64) (bool, time.Time, error) {
+func ClaimLock(ctx context.Context, session *gocql.Session, userID, serverID string, leaseMillis int64) (bool, time.Time, error) {
 	now := time.Now()
 	expires := now.Add(time.Duration(leaseMillis) * time.Millisecond)
 
@@ -283,12 +427,13 @@ func ClaimLock(session *gocql.Session, userID, serverID string, leaseMillis int6
         INSERT INTO user_locks (user_id, server_id, last_renewed, expires_at)
         VALUES (?, ?, ?, ?)
         IF NOT EXISTS;`
-	applied, err := session.Query(acquireCQL, userID, serverID, now, expires).
+	applied, err := lockQuery(ctx, session, acquireCQL, userID, serverID, now, expires).
 		MapScanCAS(make(map[string]interface{}))
 	if err != nil {
 		return false, time.Time{}, fmt.Errorf("failed to acquire lock: %w", err)
 	}
 	if applied {
+		metrics.LockOperations.WithLabelValues(metrics.LockAcquired).Inc()
 		return true, expires, nil
 	}
 
@@ -298,12 +443,13 @@ func ClaimLock(session *gocql.Session, userID, serverID string, leaseMillis int6
         SET last_renewed = ?, expires_at = ?
         WHERE user_id = ?
         IF server_id = ?;`
-	applied, err = session.Query(renewCQL, now, expires, userID, serverID).
+	applied, err = lockQuery(ctx, session, renewCQL, now, expires, userID, serverID).
 		MapScanCAS(make(map[string]interface{}))
 	if err != nil {
 		return false, time.Time{}, fmt.Errorf("failed to renew lock: %w", err)
 	}
 	if applied {
+		metrics.LockOperations.WithLabelValues(metrics.LockRenewed).Inc()
 		return true, expires, nil
 	}
 
@@ -313,36 +459,38 @@ func ClaimLock(session *gocql.Session, userID, serverID string, leaseMillis int6
         SET server_id = ?, last_renewed = ?, expires_at = ?
         WHERE user_id = ?
         IF expires_at < ?;`
-	applied, err = session.Query(takeoverCQL, serverID, now, expires, userID, now).
+	applied, err = lockQuery(ctx, session, takeoverCQL, serverID, now, expires, userID, now).
 		MapScanCAS(make(map[string]interface{}))
 	if err != nil {
 		return false, time.Time{}, fmt.Errorf("failed to takeover expired lock: %w", err)
 	}
 	if applied {
+		metrics.LockOperations.WithLabelValues(metrics.LockTakeover).Inc()
 		return true, expires, nil
 	}
 
 	// 4) not applied -> another server holds an unexpired lock
+	metrics.LockOperations.WithLabelValues(metrics.LockConflict).Inc()
 	return false, time.Time{}, nil
 }
 
 // ReleaseLock deletes the lock if owned by serverID.
-func ReleaseLock(session *gocql.Session, userID, serverID string) (bool, error) {
+func ReleaseLock(ctx context.Context, session *gocql.Session, userID, serverID string) (bool, error) {
 	deleteCQL := `
 		DELETE FROM user_locks
 		WHERE user_id = ?
 		IF server_id = ?;
 	`
-	applied, err := session.Query(deleteCQL, userID, serverID).MapScanCAS(make(map[string]interface{}))
+	applied, err := lockQuery(ctx, session, deleteCQL, userID, serverID).MapScanCAS(make(map[string]interface{}))
 	return applied, err
 }
 
 // GetLockStatus returns (locked, ownerServerID, expiresAt, error).
-func GetLockStatus(session *gocql.Session, userID gocql.UUID) (bool, string, time.Time, error) {
+func GetLockStatus(ctx context.Context, session *gocql.Session, userID gocql.UUID) (bool, string, time.Time, error) {
 	var sid string
 	var expiresAt time.Time
 	statusCQL := `SELECT server_id, expires_at FROM user_locks WHERE user_id = ? LIMIT 1`
-	err := session.Query(statusCQL, userID).Scan(&sid, &expiresAt)
+	err := readQuery(ctx, session, statusCQL, userID).Scan(&sid, &expiresAt)
 	if err != nil {
 		if err == gocql.ErrNotFound {
 			return false, "", time.Time{}, nil
@@ -360,10 +508,21 @@ func GetLockStatus(session *gocql.Session, userID gocql.UUID) (bool, string, tim
 
 // Exists returns true if table contains at least one row where
 // each key in superKeys equals its corresponding value
-func Exists(session *gocql.Session, table string, superKeys map[string]string) (bool, error) {
+func Exists(ctx context.Context, session *gocql.Session, table string, superKeys map[string]string) (bool, error) {
+	if !isSafeIdentifier(table) {
+		return false, invalidRequest("invalid table name: %s", table)
+	}
+
+	if len(superKeys) == 0 {
+		return false, invalidRequest("must specify at least one superkey")
+	}
+
 	var preds []string
 	var args []interface{}
 	for col, val := range superKeys {
+		if !isSafeIdentifier(col) {
+			return false, invalidRequest("invalid superkey name: %s", col)
+		}
 		preds = append(preds, fmt.Sprintf("%s = ?", col))
 		args = append(args, val)
 	}
@@ -374,7 +533,7 @@ func Exists(session *gocql.Session, table string, superKeys map[string]string) (
 		"SELECT * FROM %s WHERE %s LIMIT 1;",
 		table, where,
 	)
-	iter := session.Query(cql, args...).Iter()
+	iter := readQuery(ctx, session, cql, args...).Iter()
 
 	// Try to map one row into a dummy map
 	if iter.MapScan(make(map[string]interface{})) {
@@ -0,0 +1,73 @@
+// Package logging sets up the structured logger of the trove-server and carries per-request loggers through contexts.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"runtime/debug"
+	"strings"
+
+	"github.com/Runic-Studios/Trove/server/internal/config"
+)
+
+// redactedKeys are attribute keys whose values never reach the log output
+var redactedKeys = map[string]bool{
+	"authorization": true,
+	"password":      true,
+	"secret":        true,
+	"token":         true,
+}
+
+// Setup installs the default slog logger, which the standard log package also writes through.
+// The level is the minimum level logged (debug, info, warn or error) and the format
+// chooses between human-readable text and JSON lines for Loki.
+func Setup(cfg config.Logging) error {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: lvl, ReplaceAttr: redact}
+	var handler slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	default:
+		return fmt.Errorf("invalid log format %q, must be text or json", cfg.Format)
+	}
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+func redact(_ []string, a slog.Attr) slog.Attr {
+	if redactedKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, "[redacted]")
+	}
+	return a
+}
+
+type loggerKey struct{}
+
+// WithLogger returns a context carrying logger, which FromContext hands to everything serving the request.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// FromContext returns the request's logger, or the default logger outside of a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// Internal logs a genuine internal error, one that points at a bug or a broken dependency,
+// together with the stack that led to it.
+func Internal(ctx context.Context, msg string, err error, args ...any) {
+	args = append(args, slog.Any("error", err), slog.String("stack", string(debug.Stack())))
+	FromContext(ctx).ErrorContext(ctx, msg, args...)
+}
@@ -0,0 +1,151 @@
+// Package metrics holds the Prometheus collectors of the trove-server, served on /metrics.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/gocql/gocql"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Lock outcomes counted by LockOperations
+const (
+	LockAcquired = "acquired"
+	LockRenewed  = "renewed"
+	LockTakeover = "takeover"
+	LockConflict = "conflict"
+	LockExpired  = "expired"
+)
+
+// Reasons requests are rejected for, counted by Rejections
+const (
+	RejectServerRate = "server_rate"
+	RejectUserRate   = "user_rate"
+	RejectColumns    = "columns"
+	RejectBlobSize   = "blob_size"
+)
+
+var (
+	// RPCDuration is the latency of every RPC by method and status code
+	RPCDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trove_rpc_duration_seconds",
+		Help:    "Latency of trove RPCs.",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"method", "code"})
+
+	// RPCErrors counts failed RPCs by method and status code
+	RPCErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trove_rpc_errors_total",
+		Help: "Failed trove RPCs.",
+	}, []string{"method", "code"})
+
+	// LockOperations counts lock claims by outcome, and in-memory locks dropped once expired
+	LockOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trove_lock_operations_total",
+		Help: "Lock acquires, renews, takeovers, conflicts and expirations.",
+	}, []string{"outcome"})
+
+	// TransformDuration is the time taken by each hop of the transformer chain
+	TransformDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trove_transform_duration_seconds",
+		Help:    "Duration of a single transformer hop.",
+		Buckets: prometheus.ExponentialBuckets(0.0001, 2, 15),
+	}, []string{"table", "column", "from", "to"})
+
+	// TransformFailures counts transformer hops that returned an error
+	TransformFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trove_transform_failures_total",
+		Help: "Transformer hops that failed.",
+	}, []string{"table", "column", "from", "to"})
+
+	// BlobSize is the uncompressed size of blobs saved and loaded per table and column
+	BlobSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trove_blob_size_bytes",
+		Help:    "Size of column blobs saved to and loaded from Scylla.",
+		Buckets: prometheus.ExponentialBuckets(64, 4, 10),
+	}, []string{"table", "column", "op"})
+
+	// Rejections counts requests turned away by rate or size limits, by method and reason
+	Rejections = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trove_rejected_requests_total",
+		Help: "Requests rejected for going over a rate limit or carrying too much.",
+	}, []string{"method", "reason"})
+
+	// CompressionRatio is the size of each compressed blob saved, as a fraction of its uncompressed size
+	CompressionRatio = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trove_blob_compression_ratio",
+		Help:    "Compressed size of saved blobs over their uncompressed size.",
+		Buckets: prometheus.LinearBuckets(0.1, 0.1, 10),
+	}, []string{"table", "column", "codec"})
+
+	// ReencryptedBlobs counts blobs re-sealed with the primary key after a key rotation, per table and column
+	ReencryptedBlobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "trove_reencrypted_blobs_total",
+		Help: "Blobs of encrypted columns re-sealed with the primary key.",
+	}, []string{"table", "column"})
+
+	// QueryDuration is the latency of every CQL query attempt, gathered by QueryObserver
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "trove_scylla_query_duration_seconds",
+		Help:    "Latency of CQL query attempts.",
+		Buckets: prometheus.ExponentialBuckets(0.0005, 2, 15),
+	}, []string{"keyspace", "result"})
+)
+
+// RegisterActiveLocks reports the number of in-memory locks, counted by count on every scrape.
+func RegisterActiveLocks(count func() float64) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "trove_active_locks",
+		Help: "Locks currently held in this server's memory.",
+	}, count)
+}
+
+// QueryObserver records the latency of every CQL query attempt made through a gocql session.
+type QueryObserver struct{}
+
+// ObserveQuery implements gocql.QueryObserver.
+func (QueryObserver) ObserveQuery(_ context.Context, q gocql.ObservedQuery) {
+	result := "ok"
+	if q.Err != nil {
+		result = "error"
+	}
+	QueryDuration.WithLabelValues(q.Keyspace, result).Observe(q.End.Sub(q.Start).Seconds())
+}
+
+// UnaryInterceptor records the latency and status code of every unary RPC.
+func UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	observeRPC(info.FullMethod, start, err)
+	return resp, err
+}
+
+// StreamInterceptor records the duration and status code of every streaming RPC.
+func StreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	observeRPC(info.FullMethod, start, err)
+	return err
+}
+
+func observeRPC(method string, start time.Time, err error) {
+	code := status.Code(err).String()
+	RPCDuration.WithLabelValues(method, code).Observe(time.Since(start).Seconds())
+	if err != nil {
+		RPCErrors.WithLabelValues(method, code).Inc()
+	}
+}
@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"github.com/Runic-Studios/Trove/server/internal/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Role decides which RPCs a caller may make.
+type Role string
+
+const (
+	// RoleGameServer may claim locks as its own server_ids and read and write the players it holds,
+	// whose rows are checked against the lock by TroveServer.validateLock.
+	RoleGameServer Role = "game_server"
+	// RoleProxy may read public columns, watch changes and send mail.
+	RoleProxy Role = "proxy"
+	// RoleAdmin may call every RPC, as any server_id.
+	RoleAdmin Role = "admin"
+	// RoleAnalytics may only read, without locks: public columns, batches of them, and the state of
+	// migrations and quarantine. Exists is left out, since it needs a lock the role cannot claim.
+	RoleAnalytics Role = "analytics"
+)
+
+// rolePermissions lists the TroveService methods each role may call, besides admins who may call all of them
+var rolePermissions = map[Role]map[string]bool{
+	RoleGameServer: {
+		trove.TroveService_ClaimLock_FullMethodName:      true,
+		trove.TroveService_ReleaseLock_FullMethodName:    true,
+		trove.TroveService_Exists_FullMethodName:         true,
+		trove.TroveService_Save_FullMethodName:           true,
+		trove.TroveService_Patch_FullMethodName:          true,
+		trove.TroveService_GetMapEntry_FullMethodName:    true,
+		trove.TroveService_PutMapEntry_FullMethodName:    true,
+		trove.TroveService_RemoveMapEntry_FullMethodName: true,
+		trove.TroveService_Load_FullMethodName:           true,
+		trove.TroveService_PublicLoad_FullMethodName:     true,
+		trove.TroveService_BatchLoad_FullMethodName:      true,
+		trove.TroveService_Watch_FullMethodName:          true,
+		trove.TroveService_SendMail_FullMethodName:       true,
+		trove.TroveService_ClaimMail_FullMethodName:      true,
+	},
+	RoleProxy: {
+		trove.TroveService_PublicLoad_FullMethodName: true,
+		trove.TroveService_Watch_FullMethodName:      true,
+		trove.TroveService_SendMail_FullMethodName:   true,
+	},
+	RoleAnalytics: {
+		trove.TroveService_PublicLoad_FullMethodName:      true,
+		trove.TroveService_BatchLoad_FullMethodName:       true,
+		trove.TroveService_Watch_FullMethodName:           true,
+		trove.TroveService_MigrationStatus_FullMethodName: true,
+		trove.TroveService_ListQuarantined_FullMethodName: true,
+	},
+}
+
+// Principal is a caller, identified by its client certificate or by a bearer token.
+type Principal struct {
+	// Name is matched against the common name and DNS and URI SANs of a verified client certificate
+	Name string
+	// TokenSHA256 is the SHA-256 of the bearer token the caller may authenticate with, if any
+	TokenSHA256 []byte
+	Role        Role
+	// ServerIDs are the server_ids the caller may claim locks as, defaulting to its name
+	ServerIDs []string
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller authenticated for the RPC, if auth is enabled.
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// Authenticator identifies the caller of every TroveService RPC from its verified client certificate,
+// or from an "authorization: Bearer <token>" header, and checks that its role allows the RPC
+// and that it only uses its own server_ids. The health and reflection services stay open.
+type Authenticator struct {
+	byName  map[string]*Principal
+	byToken map[[sha256.Size]byte]*Principal
+}
+
+// NewAuthenticator creates an authenticator accepting the given principals.
+func NewAuthenticator(principals []Principal) *Authenticator {
+	a := &Authenticator{
+		byName:  make(map[string]*Principal, len(principals)),
+		byToken: make(map[[sha256.Size]byte]*Principal, len(principals)),
+	}
+	for i := range principals {
+		p := &principals[i]
+		if len(p.ServerIDs) == 0 {
+			p.ServerIDs = []string{p.Name}
+		}
+		a.byName[p.Name] = p
+		if len(p.TokenSHA256) == sha256.Size {
+			a.byToken[[sha256.Size]byte(p.TokenSHA256)] = p
+		}
+	}
+	return a
+}
+
+// UnaryInterceptor authenticates and authorizes every unary TroveService RPC.
+func (a *Authenticator) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if !isTroveMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	ctx, err := a.check(ctx, info.FullMethod, req)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// StreamInterceptor authenticates and authorizes every streaming TroveService RPC.
+func (a *Authenticator) StreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if !isTroveMethod(info.FullMethod) {
+		return handler(srv, ss)
+	}
+	ctx, err := a.check(ss.Context(), info.FullMethod, nil)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+}
+
+// check authenticates the caller and authorizes the request, returning a context carrying the caller.
+func (a *Authenticator) check(ctx context.Context, method string, req interface{}) (context.Context, error) {
+	p, err := a.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.authorize(method, req); err != nil {
+		return nil, err
+	}
+	ctx = context.WithValue(ctx, principalKey{}, p)
+	ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With(slog.String("caller", p.Name)))
+	return ctx, nil
+}
+
+// authenticate identifies the caller, preferring a bearer token over the client certificate.
+func (a *Authenticator) authenticate(ctx context.Context) (*Principal, error) {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get("authorization"); len(values) > 0 {
+			token, ok := strings.CutPrefix(values[0], "Bearer ")
+			if !ok || token == "" {
+				return nil, statusError(codes.Unauthenticated, "authorization header must be a bearer token")
+			}
+			if p, ok := a.byToken[sha256.Sum256([]byte(token))]; ok {
+				return p, nil
+			}
+			return nil, statusError(codes.Unauthenticated, "unknown bearer token")
+		}
+	}
+
+	if pr, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := pr.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			cert := tlsInfo.State.VerifiedChains[0][0]
+			for _, name := range certificateNames(cert) {
+				if p, ok := a.byName[name]; ok {
+					return p, nil
+				}
+			}
+			return nil, statusError(codes.Unauthenticated,
+				fmt.Sprintf("client certificate %q does not belong to a known caller", cert.Subject.CommonName))
+		}
+	}
+	return nil, statusError(codes.Unauthenticated, "a client certificate or bearer token is required")
+}
+
+// authorize checks that the principal's role may call method, and that every server_id in the request is its own.
+func (p *Principal) authorize(method string, req interface{}) error {
+	if p.Role == RoleAdmin {
+		return nil
+	}
+	if !rolePermissions[p.Role][method] {
+		return statusError(codes.PermissionDenied, fmt.Sprintf("role %s may not call %s", p.Role, method))
+	}
+	for _, serverID := range requestServerIDs(req) {
+		if !slices.Contains(p.ServerIDs, serverID) {
+			return statusError(codes.PermissionDenied, fmt.Sprintf("%s may not act as server_id %s", p.Name, serverID))
+		}
+	}
+	return nil
+}
+
+// requestServerIDs returns every server_id a request acts as, including those of the locks in a BatchLoad.
+func requestServerIDs(req interface{}) []string {
+	var serverIDs []string
+	if _, _, serverID := requestFields(req); serverID != "" {
+		serverIDs = append(serverIDs, serverID)
+	}
+	if batch, ok := req.(*trove.BatchLoadRequest); ok {
+		for _, key := range batch.GetKeys() {
+			if serverID := key.GetLock().GetServerId(); serverID != "" {
+				serverIDs = append(serverIDs, serverID)
+			}
+		}
+	}
+	return serverIDs
+}
+
+// certificateNames returns the names a client certificate identifies its holder by.
+func certificateNames(cert *x509.Certificate) []string {
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	for _, uri := range cert.URIs {
+		names = append(names, uri.String())
+	}
+	return names
+}
+
+func isTroveMethod(method string) bool {
+	return strings.HasPrefix(method, "/"+trove.TroveService_ServiceDesc.ServiceName+"/")
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+)
+
+// RPCTracker counts the RPCs in flight, so that shutdown can report how many it drained.
+type RPCTracker struct {
+	inFlight atomic.Int64
+}
+
+// InFlight returns how many RPCs are running right now.
+func (t *RPCTracker) InFlight() int64 {
+	return t.inFlight.Load()
+}
+
+// UnaryInterceptor counts a unary RPC while it runs.
+func (t *RPCTracker) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	t.inFlight.Add(1)
+	defer t.inFlight.Add(-1)
+	return handler(ctx, req)
+}
+
+// StreamInterceptor counts a streaming RPC while it runs.
+func (t *RPCTracker) StreamInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	_ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	t.inFlight.Add(1)
+	defer t.inFlight.Add(-1)
+	return handler(srv, ss)
+}
@@ -0,0 +1,324 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Runic-Studios/Trove/server/internal/db"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultDryRunExamples = 5
+
+// DryRunOptions limits how much of a table a dry run scans.
+type DryRunOptions struct {
+	// SampleRanges scans only this many randomly chosen token ranges, or the whole table when <= 0.
+	SampleRanges int
+	// MaxRows stops the scan after this many rows, or never when <= 0.
+	MaxRows int64
+	// MaxExamples is the number of example keys kept per failure, defaulting when <= 0.
+	MaxExamples int
+}
+
+// DryRunFailure groups every row that failed with the same error.
+type DryRunFailure struct {
+	Error       string
+	Count       int64
+	ExampleKeys []string
+}
+
+// DryRunColumn summarises the transformed blobs of one column.
+type DryRunColumn struct {
+	Column           string
+	Transformed      int64
+	BytesBefore      int64
+	BytesAfter       int64
+	DecodeMismatches int64
+}
+
+// DryRunReport is the result of running the transformer chain over a table without writing anything.
+type DryRunReport struct {
+	TargetVersion   string
+	RowsScanned     int64
+	RowsOutdated    int64
+	RowsTransformed int64
+	RowsFailed      int64
+	Failures        []DryRunFailure
+	Columns         []DryRunColumn
+}
+
+// DryRunStatus is a snapshot of a dry run job: its report so far, and how far it got.
+type DryRunStatus struct {
+	Running         bool
+	CompletedRanges int
+	TotalRanges     int
+	LastError       string
+	Report          DryRunReport
+}
+
+// dryRunJob is a single background dry run over one table.
+type dryRunJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+	// opts are the options the job was started with, MaxExamples defaulted
+	opts DryRunOptions
+
+	mu              sync.Mutex
+	report          DryRunReport
+	failures        map[string]*DryRunFailure
+	columns         map[string]*DryRunColumn
+	completedRanges int
+	totalRanges     int
+	lastError       string
+}
+
+// DryRun starts a background dry run of table, unless one has already been started by this server
+// and restart is not set, and returns a snapshot of it. A dry run already started with other options
+// fails with FailedPrecondition rather than report on options that were not asked for.
+func (m *Migrator) DryRun(ctx context.Context, table string, opts DryRunOptions, restart bool) (DryRunStatus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if opts.MaxExamples <= 0 {
+		opts.MaxExamples = defaultDryRunExamples
+	}
+	if job, ok := m.dryRuns[table]; ok && !restart {
+		if job.opts != opts {
+			return DryRunStatus{}, status.Errorf(codes.FailedPrecondition,
+				"a dry run of %s was started with other options, pass the same options to poll it or restart to start over",
+				table)
+		}
+		return job.status(), nil
+	} else if ok {
+		job.cancel()
+		<-job.done
+	}
+
+	schema, err := db.LoadTableSchema(ctx, m.session, db.Keyspace(), table)
+	if err != nil {
+		return DryRunStatus{}, fmt.Errorf("failed to load schema of %s: %w", table, err)
+	}
+
+	ranges := db.SplitTokenRing(migrationTokenRanges)
+	if opts.SampleRanges > 0 && opts.SampleRanges < len(ranges) {
+		rand.Shuffle(len(ranges), func(i, j int) { ranges[i], ranges[j] = ranges[j], ranges[i] })
+		ranges = ranges[:opts.SampleRanges]
+	}
+
+	// the job outlives the request that started it
+	jobCtx, cancel := context.WithCancel(context.Background())
+	job := &dryRunJob{
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		opts:        opts,
+		report:      DryRunReport{TargetVersion: m.transformers.LatestVersion},
+		failures:    make(map[string]*DryRunFailure),
+		columns:     make(map[string]*DryRunColumn),
+		totalRanges: len(ranges),
+	}
+	m.dryRuns[table] = job
+
+	go func() {
+		defer close(job.done)
+		err := m.dryRun(jobCtx, job, table, schema, ranges, opts)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("migration dry run stopped", slog.String("table", table), slog.Any("error", err))
+			job.mu.Lock()
+			job.lastError = err.Error()
+			job.mu.Unlock()
+		}
+	}()
+	return job.status(), nil
+}
+
+// dryRun scans the given token ranges of table and runs TransformUp over every outdated row without
+// writing anything back. Transformed blobs are also round-tripped through the column's message type
+// to catch output that does not decode cleanly. Rows are transformed outside job.mu, so status
+// never waits on a transformer.
+func (m *Migrator) dryRun(
+	ctx context.Context,
+	job *dryRunJob,
+	table string,
+	schema db.TableSchema,
+	ranges []db.TokenRange,
+	opts DryRunOptions,
+) error {
+	latest := m.transformers.LatestVersion
+	report := &job.report
+	fail := func(row db.ScannedRow, msg string) {
+		f, ok := job.failures[msg]
+		if !ok {
+			f = &DryRunFailure{Error: msg}
+			job.failures[msg] = f
+		}
+		f.Count++
+		if len(f.ExampleKeys) < opts.MaxExamples {
+			f.ExampleKeys = append(f.ExampleKeys, formatKeys(row.Keys))
+		}
+	}
+
+	errLimitReached := errors.New("row limit reached")
+	for _, tokenRange := range ranges {
+		err := db.ScanTokenRange(ctx, m.session, table, schema, schema.BlobColumns, tokenRange, migrationPageSize,
+			func(row db.ScannedRow) error {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				job.mu.Lock()
+				if opts.MaxRows > 0 && report.RowsScanned >= opts.MaxRows {
+					job.mu.Unlock()
+					return errLimitReached
+				}
+				report.RowsScanned++
+				job.mu.Unlock()
+				if row.SchemaVersion == latest {
+					return nil
+				}
+
+				// transform every column, then record the results together
+				type result struct {
+					column                     string
+					before, after              int
+					transformErr, roundTripErr string
+				}
+				results := make([]result, 0, len(row.Data))
+				for column, datum := range row.Data {
+					r := result{column: column, before: len(datum)}
+					if dataUp, err := m.transformers.TransformUp(table, column, row.SchemaVersion, datum); err != nil {
+						r.transformErr = err.Error()
+					} else {
+						r.after = len(dataUp)
+						if err := m.checkRoundTrip(table, column, dataUp); err != nil {
+							r.roundTripErr = err.Error()
+						}
+					}
+					results = append(results, r)
+				}
+
+				job.mu.Lock()
+				defer job.mu.Unlock()
+				report.RowsOutdated++
+				ok := true
+				for _, r := range results {
+					if r.transformErr != "" {
+						fail(row, r.transformErr)
+						ok = false
+						continue
+					}
+					c, found := job.columns[r.column]
+					if !found {
+						c = &DryRunColumn{Column: r.column}
+						job.columns[r.column] = c
+					}
+					c.Transformed++
+					c.BytesBefore += int64(r.before)
+					c.BytesAfter += int64(r.after)
+					if r.roundTripErr != "" {
+						c.DecodeMismatches++
+						fail(row, r.roundTripErr)
+						ok = false
+					}
+				}
+				if ok {
+					report.RowsTransformed++
+				} else {
+					report.RowsFailed++
+				}
+				return nil
+			})
+		if errors.Is(err, errLimitReached) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		job.mu.Lock()
+		job.completedRanges++
+		job.mu.Unlock()
+	}
+	return nil
+}
+
+// status returns a snapshot of the job, with failures most frequent first and columns by name.
+func (job *dryRunJob) status() DryRunStatus {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	running := true
+	select {
+	case <-job.done:
+		running = false
+	default:
+	}
+	report := job.report
+	report.Failures = make([]DryRunFailure, 0, len(job.failures))
+	for _, f := range job.failures {
+		f := *f
+		f.ExampleKeys = slices.Clone(f.ExampleKeys)
+		report.Failures = append(report.Failures, f)
+	}
+	sort.Slice(report.Failures, func(i, j int) bool { return report.Failures[i].Count > report.Failures[j].Count })
+	report.Columns = make([]DryRunColumn, 0, len(job.columns))
+	for _, c := range job.columns {
+		report.Columns = append(report.Columns, *c)
+	}
+	sort.Slice(report.Columns, func(i, j int) bool { return report.Columns[i].Column < report.Columns[j].Column })
+	return DryRunStatus{
+		Running:         running,
+		CompletedRanges: job.completedRanges,
+		TotalRanges:     job.totalRanges,
+		LastError:       job.lastError,
+		Report:          report,
+	}
+}
+
+// checkRoundTrip decodes a transformed blob into the column's message type, failing if it cannot be
+// decoded or carries fields the target type does not know about, then re-encodes it and decodes it again,
+// failing if the message does not survive. Re-encoded bytes may legitimately differ from the transformer's
+// output in field and map entry order, so the messages are compared rather than the bytes.
+func (m *Migrator) checkRoundTrip(table, column string, data []byte) error {
+	mt, ok := m.transformers.ColumnType(table, column)
+	if !ok {
+		return nil
+	}
+	name := mt.Descriptor().FullName()
+	msg := mt.New().Interface()
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return fmt.Errorf("round-trip decode of %s.%s into %s failed: %w", table, column, name, err)
+	}
+	if unknown := msg.ProtoReflect().GetUnknown(); len(unknown) > 0 {
+		return fmt.Errorf("round-trip decode of %s.%s into %s left unknown fields", table, column, name)
+	}
+	encoded, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("round-trip encode of %s.%s as %s failed: %w", table, column, name, err)
+	}
+	if bytes.Equal(encoded, data) {
+		return nil
+	}
+	again := mt.New().Interface()
+	if err := proto.Unmarshal(encoded, again); err != nil || !proto.Equal(msg, again) {
+		return fmt.Errorf("%s.%s does not round-trip through %s", table, column, name)
+	}
+	return nil
+}
+
+// formatKeys renders a primary key as "k1=v1, k2=v2" in key order.
+func formatKeys(keys map[string]string) string {
+	parts := make([]string, 0, len(keys))
+	for k, v := range keys {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDryRunOptionsOfStartedJob(t *testing.T) {
+	started := DryRunOptions{SampleRanges: 16, MaxExamples: defaultDryRunExamples}
+
+	tests := []struct {
+		name     string
+		opts     DryRunOptions
+		wantCode codes.Code
+	}{
+		{"same options", DryRunOptions{SampleRanges: 16}, codes.OK},
+		{"same options with examples spelled out", started, codes.OK},
+		{"other sample", DryRunOptions{SampleRanges: 32}, codes.FailedPrecondition},
+		{"no options", DryRunOptions{}, codes.FailedPrecondition},
+		{"other row limit", DryRunOptions{SampleRanges: 16, MaxRows: 100}, codes.FailedPrecondition},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job := &dryRunJob{done: make(chan struct{}), opts: started, totalRanges: 16}
+			m := &Migrator{dryRuns: map[string]*dryRunJob{"players": job}}
+
+			got, err := m.DryRun(context.Background(), "players", tt.opts, false)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("DryRun() error = %v, want code %s", err, tt.wantCode)
+			}
+			if err == nil && (!got.Running || got.TotalRanges != 16) {
+				t.Errorf("DryRun() = %+v, want the running job's status", got)
+			}
+		})
+	}
+}
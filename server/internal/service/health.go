@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"github.com/Runic-Studios/Trove/server/internal/db"
+	"github.com/gocql/gocql"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// healthCheckInterval is how often readiness is re-evaluated
+	healthCheckInterval = 5 * time.Second
+	// healthCheckTimeout bounds the Scylla ping of a single check
+	healthCheckTimeout = 2 * time.Second
+	// maxEvictionRuns is how many runs the lock evictor may miss before the server is not ready
+	maxEvictionRuns = 3
+)
+
+// Health tracks whether this server can take traffic, from a periodic Scylla ping and the state of
+// the lock evictor, and reports it through the grpc.health.v1 service and HTTP /healthz and /readyz.
+type Health struct {
+	session *gocql.Session
+	server  *TroveServer
+	grpc    *health.Server
+
+	mu       sync.Mutex
+	notReady string // why the server is not ready, or empty if it is
+	shutdown bool
+}
+
+// NewHealth creates a health tracker which reports not ready until its first check passes.
+func NewHealth(session *gocql.Session, server *TroveServer) *Health {
+	h := &Health{
+		session:  session,
+		server:   server,
+		grpc:     health.NewServer(),
+		notReady: "starting up",
+	}
+	h.setServing(healthpb.HealthCheckResponse_NOT_SERVING)
+	return h
+}
+
+// GRPC returns the grpc.health.v1 service to register on the gRPC server.
+func (h *Health) GRPC() *health.Server {
+	return h.grpc
+}
+
+// Run re-evaluates readiness every healthCheckInterval until ctx is done.
+func (h *Health) Run(ctx context.Context) {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		h.update(h.check(ctx))
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// check returns why the server is not ready, or an empty string if it is.
+func (h *Health) check(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	if err := db.Ping(ctx, h.session); err != nil {
+		return fmt.Sprintf("scylla ping failed: %v", err)
+	}
+	lastEviction := time.UnixMilli(h.server.lastEviction.Load())
+	if age := time.Since(lastEviction); age > maxEvictionRuns*h.server.lockPolicy.EvictionInterval {
+		return fmt.Sprintf("lock evictor has not run for %s", age.Round(time.Second))
+	}
+	return ""
+}
+
+func (h *Health) update(notReady string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shutdown || notReady == h.notReady {
+		return
+	}
+	h.notReady = notReady
+	if notReady == "" {
+		h.setServing(healthpb.HealthCheckResponse_SERVING)
+	} else {
+		h.setServing(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+// Shutdown reports the server as not ready for good, so that traffic moves elsewhere while it drains.
+func (h *Health) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shutdown = true
+	h.notReady = "shutting down"
+	h.grpc.Shutdown()
+}
+
+// setServing reports status for the whole server and for TroveService alone.
+func (h *Health) setServing(status healthpb.HealthCheckResponse_ServingStatus) {
+	h.grpc.SetServingStatus("", status)
+	h.grpc.SetServingStatus(trove.TroveService_ServiceDesc.ServiceName, status)
+}
+
+// Handler serves /healthz, which succeeds while the process is up, and /readyz,
+// which succeeds only while the server is ready for traffic.
+func (h *Health) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		h.mu.Lock()
+		notReady := h.notReady
+		h.mu.Unlock()
+		if notReady != "" {
+			http.Error(w, notReady, http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
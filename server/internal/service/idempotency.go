@@ -0,0 +1,148 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// idempotentRequest is implemented by every request message with an idempotency_key field.
+type idempotentRequest interface {
+	proto.Message
+	GetIdempotencyKey() string
+}
+
+// idempotentCall is the first call made with an idempotency key, which later calls replay.
+type idempotentCall struct {
+	fingerprint [sha256.Size]byte
+	done        chan struct{}
+	resp        interface{}
+	expiresAt   time.Time
+}
+
+// IdempotencyCache remembers the responses of successful mutating requests by idempotency key,
+// so that a client retrying a request which already landed gets the original response back
+// instead of applying it twice. Keys are scoped to the caller, so one caller cannot replay or
+// block another's key. They are remembered in memory on each replica: a retry that reaches a
+// different trove-server replica than the original call is applied again.
+type IdempotencyCache struct {
+	ttl  time.Duration
+	stop chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]*idempotentCall
+}
+
+// NewIdempotencyCache creates a cache replaying responses for ttl, and starts evicting expired keys.
+func NewIdempotencyCache(ttl time.Duration) *IdempotencyCache {
+	c := &IdempotencyCache{ttl: ttl, stop: make(chan struct{}), calls: make(map[string]*idempotentCall)}
+	go c.evictExpired()
+	return c
+}
+
+// Close stops evicting expired keys.
+func (c *IdempotencyCache) Close() {
+	close(c.stop)
+}
+
+// evictExpired runs every minute to purge expired keys, until the cache is closed.
+func (c *IdempotencyCache) evictExpired() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-c.stop:
+			return
+		case now = <-ticker.C:
+		}
+		c.mu.Lock()
+		for key, call := range c.calls {
+			if !call.expiresAt.IsZero() && now.After(call.expiresAt) {
+				delete(c.calls, key)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// UnaryInterceptor runs a request carrying an idempotency key at most once while the key is remembered.
+// A repeat of a successful call returns its original response; a repeat of a call still in flight waits
+// for it; a failed call is forgotten so that it can be retried. Reusing a key for a different request
+// is rejected.
+func (c *IdempotencyCache) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	idempotent, ok := req.(idempotentRequest)
+	if !ok || idempotent.GetIdempotencyKey() == "" {
+		return handler(ctx, req)
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(idempotent)
+	if err != nil {
+		return handler(ctx, req)
+	}
+	fingerprint := sha256.Sum256(data)
+	key := info.FullMethod + "/" + idempotencyScope(ctx, req) + "/" + idempotent.GetIdempotencyKey()
+
+	for {
+		c.mu.Lock()
+		call, ok := c.calls[key]
+		if ok && !call.expiresAt.IsZero() && time.Now().After(call.expiresAt) {
+			delete(c.calls, key)
+			ok = false
+		}
+		if !ok {
+			break
+		}
+		c.mu.Unlock()
+
+		if call.fingerprint != fingerprint {
+			return nil, invalidArgument("idempotency_key was already used for a different request", "idempotency_key")
+		}
+		select {
+		case <-call.done:
+		case <-ctx.Done():
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		if call.resp != nil {
+			return call.resp, nil
+		}
+		// the original call failed and was forgotten, so try to run it again
+	}
+
+	call := &idempotentCall{fingerprint: fingerprint, done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	resp, err := handler(ctx, req)
+
+	c.mu.Lock()
+	if err == nil {
+		call.resp = resp
+		call.expiresAt = time.Now().Add(c.ttl)
+	} else {
+		delete(c.calls, key)
+	}
+	c.mu.Unlock()
+	close(call.done)
+	return resp, err
+}
+
+// idempotencyScope returns who a request's idempotency key belongs to: its authenticated principal,
+// if any, and the server_id it acts as.
+func idempotencyScope(ctx context.Context, req interface{}) string {
+	_, _, serverID := requestFields(req)
+	if p, ok := PrincipalFromContext(ctx); ok {
+		return p.Name + "/" + serverID
+	}
+	return serverID
+}
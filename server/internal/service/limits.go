@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"github.com/Runic-Studios/Trove/server/internal/db"
+	"github.com/Runic-Studios/Trove/server/internal/metrics"
+	"golang.org/x/time/rate"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RateLimit allows Rate requests per second on average, in bursts of up to Burst. A zero Rate is unlimited.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// LimitPolicy bounds how often each caller may call, and how much a single request may carry.
+type LimitPolicy struct {
+	// PerServer limits the requests made as each server_id, or by each authenticated caller without one
+	PerServer RateLimit
+	// PerUser limits the requests about each player
+	PerUser RateLimit
+	// MaxColumns is the most columns a request may save or load, unlimited if zero
+	MaxColumns int
+	// MaxBlobBytes is the largest blob a request may write to a column, unlimited if zero
+	MaxBlobBytes int
+	// ColumnBlobBytes overrides MaxBlobBytes per "table.column"
+	ColumnBlobBytes map[string]int
+}
+
+// maxBlobBytes returns the largest blob that may be written to table.column, or zero if unlimited.
+func (p LimitPolicy) maxBlobBytes(table, column string) int {
+	if limit, ok := p.ColumnBlobBytes[table+"."+column]; ok {
+		return limit
+	}
+	return p.MaxBlobBytes
+}
+
+// Limiter rejects unary TroveService RPCs from callers going over their rate limit, and requests
+// carrying more columns or larger blobs than the policy allows, with RESOURCE_EXHAUSTED.
+// Rates are tracked in memory, per server.
+type Limiter struct {
+	policy LimitPolicy
+	stop   chan struct{}
+
+	mu      sync.Mutex
+	servers map[string]*rate.Limiter
+	users   map[string]*rate.Limiter
+}
+
+// NewLimiter creates a limiter enforcing policy, and starts forgetting callers that went quiet.
+func NewLimiter(policy LimitPolicy) *Limiter {
+	l := &Limiter{
+		policy:  policy,
+		stop:    make(chan struct{}),
+		servers: make(map[string]*rate.Limiter),
+		users:   make(map[string]*rate.Limiter),
+	}
+	go l.evictIdle()
+	return l
+}
+
+// Close stops forgetting idle callers.
+func (l *Limiter) Close() {
+	close(l.stop)
+}
+
+// evictIdle runs every minute to drop the buckets that have refilled, which a new bucket would
+// replace exactly, until the limiter is closed.
+func (l *Limiter) evictIdle() {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		var now time.Time
+		select {
+		case <-l.stop:
+			return
+		case now = <-ticker.C:
+		}
+		l.mu.Lock()
+		for _, buckets := range []map[string]*rate.Limiter{l.servers, l.users} {
+			for key, bucket := range buckets {
+				if bucket.TokensAt(now) >= float64(bucket.Burst()) {
+					delete(buckets, key)
+				}
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+// UnaryInterceptor checks the size of every unary TroveService request, then takes a token from the
+// buckets of its server_id and user. Requests rejected for either reason are counted by metrics.Rejections.
+func (l *Limiter) UnaryInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if !isTroveMethod(info.FullMethod) {
+		return handler(ctx, req)
+	}
+	if reason, err := l.checkSize(req); err != nil {
+		metrics.Rejections.WithLabelValues(info.FullMethod, reason).Inc()
+		return nil, err
+	}
+	if reason, err := l.checkRate(ctx, req); err != nil {
+		metrics.Rejections.WithLabelValues(info.FullMethod, reason).Inc()
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// checkRate takes a token for the request's server and user, failing without taking either
+// if one of them has run out.
+func (l *Limiter) checkRate(ctx context.Context, req interface{}) (string, error) {
+	_, userID, serverID := requestFields(req)
+	if serverID == "" {
+		if p, ok := PrincipalFromContext(ctx); ok {
+			serverID = p.Name
+		}
+	}
+
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var reservations []*rate.Reservation
+	take := func(buckets map[string]*rate.Limiter, limit RateLimit, key string) time.Duration {
+		if limit.Rate <= 0 || key == "" {
+			return 0
+		}
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = rate.NewLimiter(rate.Limit(limit.Rate), limit.Burst)
+			buckets[key] = bucket
+		}
+		r := bucket.ReserveN(now, 1)
+		reservations = append(reservations, r)
+		return r.DelayFrom(now)
+	}
+	serverDelay := take(l.servers, l.policy.PerServer, serverID)
+	userDelay := take(l.users, l.policy.PerUser, userID)
+	if serverDelay == 0 && userDelay == 0 {
+		return "", nil
+	}
+
+	for _, r := range reservations {
+		r.CancelAt(now)
+	}
+	if serverDelay > 0 {
+		return metrics.RejectServerRate, rateLimited("server_id", serverID, serverDelay)
+	}
+	return metrics.RejectUserRate, rateLimited("user_id", userID, userDelay)
+}
+
+// checkSize checks the number of columns a request saves or loads, and the size of every blob it writes.
+func (l *Limiter) checkSize(req interface{}) (string, error) {
+	var columns int
+	blobs := map[string]int{}
+	table, _, _ := requestFields(req)
+	switch r := req.(type) {
+	case *trove.SaveRequest:
+		columns = len(r.GetColumnData())
+		for column, data := range r.GetColumnData() {
+			blobs[column] = len(data)
+		}
+	case *trove.PatchRequest:
+		blobs[r.GetColumn()] = len(r.GetPatch())
+	case *trove.PutMapEntryRequest:
+		column, _, _ := strings.Cut(r.GetPath(), ".")
+		blobs[column] = len(r.GetValue())
+	case *trove.SendMailRequest:
+		table = db.MailboxTable
+		blobs["payload"] = len(r.GetPayload())
+	case *trove.LoadRequest:
+		columns = len(r.GetColumns())
+	case *trove.PublicLoadRequest:
+		columns = len(r.GetColumns())
+	case *trove.BatchLoadRequest:
+		columns = len(r.GetColumns())
+	}
+
+	if l.policy.MaxColumns > 0 && columns > l.policy.MaxColumns {
+		return metrics.RejectColumns, tooLarge("columns",
+			fmt.Sprintf("request has %d columns, more than the limit of %d", columns, l.policy.MaxColumns))
+	}
+	for column, size := range blobs {
+		if limit := l.policy.maxBlobBytes(table, column); limit > 0 && size > limit {
+			return metrics.RejectBlobSize, tooLarge(column,
+				fmt.Sprintf("%s.%s blob is %d bytes, more than the limit of %d", table, column, size, limit))
+		}
+	}
+	return "", nil
+}
+
+// rateLimited reports a caller that went over its rate limit, and when it may try again.
+func rateLimited(kind, key string, retryAfter time.Duration) error {
+	return statusError(codes.ResourceExhausted, fmt.Sprintf("rate limit exceeded for %s %s", kind, key),
+		&errdetails.ErrorInfo{
+			Reason:   reasonRateLimited,
+			Domain:   errorDomain,
+			Metadata: map[string]string{kind: key},
+		},
+		&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)},
+	)
+}
+
+// tooLarge reports a request carrying more than the limits allow.
+func tooLarge(subject, msg string) error {
+	return statusError(codes.ResourceExhausted, msg,
+		&errdetails.ErrorInfo{Reason: reasonTooLarge, Domain: errorDomain},
+		&errdetails.QuotaFailure{Violations: []*errdetails.QuotaFailure_Violation{{
+			Subject:     subject,
+			Description: msg,
+		}}},
+	)
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"github.com/Runic-Studios/Trove/server/internal/metrics"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLimiterCheckSize(t *testing.T) {
+	l := NewLimiter(LimitPolicy{
+		MaxColumns:      2,
+		MaxBlobBytes:    8,
+		ColumnBlobBytes: map[string]int{"players.bank": 16},
+	})
+	defer l.Close()
+	blob := func(n int) []byte { return make([]byte, n) }
+
+	tests := []struct {
+		name       string
+		req        interface{}
+		wantReason string
+		wantErr    string
+	}{
+		{
+			name: "save within limits",
+			req: &trove.SaveRequest{Table: "players", ColumnData: map[string][]byte{
+				"settings": blob(8),
+				"bank":     blob(16),
+			}},
+		},
+		{
+			name: "save with too many columns",
+			req: &trove.SaveRequest{Table: "players", ColumnData: map[string][]byte{
+				"settings": blob(1),
+				"bank":     blob(1),
+				"friends":  blob(1),
+			}},
+			wantReason: metrics.RejectColumns,
+			wantErr:    "request has 3 columns, more than the limit of 2",
+		},
+		{
+			name:       "save with a blob over the limit",
+			req:        &trove.SaveRequest{Table: "players", ColumnData: map[string][]byte{"settings": blob(9)}},
+			wantReason: metrics.RejectBlobSize,
+			wantErr:    "players.settings blob is 9 bytes, more than the limit of 8",
+		},
+		{
+			name:       "save with a blob over the column's override",
+			req:        &trove.SaveRequest{Table: "players", ColumnData: map[string][]byte{"bank": blob(17)}},
+			wantReason: metrics.RejectBlobSize,
+			wantErr:    "players.bank blob is 17 bytes, more than the limit of 16",
+		},
+		{
+			name: "override is per table",
+			req:  &trove.SaveRequest{Table: "characters", ColumnData: map[string][]byte{"bank": blob(9)}},
+			// characters.bank has no override, so the default of 8 applies
+			wantReason: metrics.RejectBlobSize,
+			wantErr:    "characters.bank blob is 9 bytes",
+		},
+		{
+			name:       "patch over the limit",
+			req:        &trove.PatchRequest{Table: "players", Column: "settings", Patch: blob(9)},
+			wantReason: metrics.RejectBlobSize,
+			wantErr:    "players.settings blob is 9 bytes",
+		},
+		{
+			name: "map entry within the column's override",
+			req:  &trove.PutMapEntryRequest{Table: "players", Path: "bank.pages[1].items[4]", Value: blob(16)},
+		},
+		{
+			name:       "map entry over the column's override",
+			req:        &trove.PutMapEntryRequest{Table: "players", Path: "bank.pages[1].items[4]", Value: blob(17)},
+			wantReason: metrics.RejectBlobSize,
+			wantErr:    "players.bank blob is 17 bytes",
+		},
+		{
+			name: "load within limits",
+			req:  &trove.LoadRequest{Table: "players", Columns: []string{"settings", "bank"}},
+		},
+		{
+			name:       "load with too many columns",
+			req:        &trove.LoadRequest{Table: "players", Columns: []string{"settings", "bank", "friends"}},
+			wantReason: metrics.RejectColumns,
+			wantErr:    "request has 3 columns",
+		},
+		{
+			name:       "batch load with too many columns",
+			req:        &trove.BatchLoadRequest{Table: "players", Columns: []string{"settings", "bank", "friends"}},
+			wantReason: metrics.RejectColumns,
+			wantErr:    "request has 3 columns",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reason, err := l.checkSize(tt.req)
+			if reason != tt.wantReason {
+				t.Errorf("checkSize() reason = %q, want %q", reason, tt.wantReason)
+			}
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkSize() error = %v", err)
+				}
+				return
+			}
+			if status.Code(err) != codes.ResourceExhausted || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("checkSize() error = %v, want RESOURCE_EXHAUSTED containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLimiterCheckRate(t *testing.T) {
+	save := func(userID, serverID string) *trove.SaveRequest {
+		return &trove.SaveRequest{Table: "players", Lock: &trove.LockInfo{UserId: userID, ServerId: serverID}}
+	}
+	// rates slow enough that no token is refilled during the test
+	tests := []struct {
+		name   string
+		policy LimitPolicy
+		ctx    context.Context
+		reqs   []*trove.SaveRequest
+		// wantReasons is the rejection reason of each request, empty if it is allowed
+		wantReasons []string
+	}{
+		{
+			name:        "unlimited",
+			policy:      LimitPolicy{},
+			reqs:        []*trove.SaveRequest{save("alice", "s1"), save("alice", "s1"), save("alice", "s1")},
+			wantReasons: []string{"", "", ""},
+		},
+		{
+			name:        "per server",
+			policy:      LimitPolicy{PerServer: RateLimit{Rate: 0.001, Burst: 2}},
+			reqs:        []*trove.SaveRequest{save("alice", "s1"), save("bob", "s1"), save("carol", "s1"), save("carol", "s2")},
+			wantReasons: []string{"", "", metrics.RejectServerRate, ""},
+		},
+		{
+			name:        "per user",
+			policy:      LimitPolicy{PerUser: RateLimit{Rate: 0.001, Burst: 1}},
+			reqs:        []*trove.SaveRequest{save("alice", "s1"), save("alice", "s2"), save("bob", "s1")},
+			wantReasons: []string{"", metrics.RejectUserRate, ""},
+		},
+		{
+			name: "request rejected by the server does not take the user's token",
+			policy: LimitPolicy{
+				PerServer: RateLimit{Rate: 0.001, Burst: 1},
+				PerUser:   RateLimit{Rate: 0.001, Burst: 2},
+			},
+			reqs:        []*trove.SaveRequest{save("alice", "s1"), save("alice", "s1"), save("alice", "s2"), save("alice", "s3")},
+			wantReasons: []string{"", metrics.RejectServerRate, "", metrics.RejectUserRate},
+		},
+		{
+			name: "request rejected by the user does not take the server's token",
+			policy: LimitPolicy{
+				PerServer: RateLimit{Rate: 0.001, Burst: 2},
+				PerUser:   RateLimit{Rate: 0.001, Burst: 1},
+			},
+			reqs:        []*trove.SaveRequest{save("alice", "s1"), save("alice", "s1"), save("bob", "s1"), save("carol", "s1")},
+			wantReasons: []string{"", metrics.RejectUserRate, "", metrics.RejectServerRate},
+		},
+		{
+			name:        "principal stands in for a missing server_id",
+			policy:      LimitPolicy{PerServer: RateLimit{Rate: 0.001, Burst: 1}},
+			ctx:         context.WithValue(context.Background(), principalKey{}, &Principal{Name: "web"}),
+			reqs:        []*trove.SaveRequest{save("alice", ""), save("bob", "")},
+			wantReasons: []string{"", metrics.RejectServerRate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewLimiter(tt.policy)
+			defer l.Close()
+			ctx := tt.ctx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			for i, req := range tt.reqs {
+				reason, err := l.checkRate(ctx, req)
+				if reason != tt.wantReasons[i] {
+					t.Fatalf("request %d: checkRate() reason = %q, want %q", i, reason, tt.wantReasons[i])
+				}
+				if reason == "" {
+					if err != nil {
+						t.Fatalf("request %d: checkRate() error = %v", i, err)
+					}
+					continue
+				}
+				if status.Code(err) != codes.ResourceExhausted {
+					t.Fatalf("request %d: checkRate() error = %v, want RESOURCE_EXHAUSTED", i, err)
+				}
+				var retry *errdetails.RetryInfo
+				for _, detail := range status.Convert(err).Details() {
+					if r, ok := detail.(*errdetails.RetryInfo); ok {
+						retry = r
+					}
+				}
+				if retry == nil || retry.GetRetryDelay().AsDuration() <= 0 {
+					t.Errorf("request %d: checkRate() retry info = %v, want a positive delay", i, retry)
+				}
+			}
+		})
+	}
+}
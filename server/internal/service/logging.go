@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/internal/logging"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDHeader carries the request ID in and out of every RPC's metadata
+const requestIDHeader = "x-request-id"
+
+// UnaryLoggingInterceptor gives every unary RPC a logger tagged with its request ID, method, table,
+// user and server, and logs how the RPC finished.
+func UnaryLoggingInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	logger := requestLogger(ctx, info.FullMethod)
+	table, userID, serverID := requestFields(req)
+	if table != "" {
+		logger = logger.With(slog.String("table", table))
+	}
+	if userID != "" {
+		logger = logger.With(slog.String("user_id", userID))
+	}
+	if serverID != "" {
+		logger = logger.With(slog.String("server_id", serverID))
+	}
+	ctx = logging.WithLogger(ctx, logger)
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logFinished(ctx, logger, start, err)
+	return resp, err
+}
+
+// StreamLoggingInterceptor gives every streaming RPC a logger tagged with its request ID and method,
+// and logs how the RPC finished.
+func StreamLoggingInterceptor(
+	srv interface{},
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	logger := requestLogger(ss.Context(), info.FullMethod)
+	ctx := logging.WithLogger(ss.Context(), logger)
+
+	start := time.Now()
+	err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	logFinished(ctx, logger, start, err)
+	return err
+}
+
+// contextStream hands a stream handler a context carrying more than the stream's own, such as its logger
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// requestLogger picks the RPC's request ID and echoes it back in the response headers.
+// A request ID sent by the client is kept, otherwise the trace ID is used so logs and traces line up,
+// and a random ID is made up when the RPC is not traced.
+func requestLogger(ctx context.Context, method string) *slog.Logger {
+	var requestID string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(requestIDHeader); len(ids) > 0 {
+			requestID = ids[0]
+		}
+	}
+	if requestID == "" {
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			requestID = sc.TraceID().String()
+		} else {
+			var id [16]byte
+			_, _ = rand.Read(id[:])
+			requestID = hex.EncodeToString(id[:])
+		}
+	}
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, requestID))
+
+	return logging.FromContext(ctx).With(
+		slog.String("request_id", requestID),
+		slog.String("method", method),
+	)
+}
+
+// logFinished logs every RPC at debug level, failures the caller caused at info level,
+// and failures on our side at warn level.
+func logFinished(ctx context.Context, logger *slog.Logger, start time.Time, err error) {
+	st := status.Convert(err)
+	level := slog.LevelDebug
+	switch st.Code() {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable, codes.DeadlineExceeded:
+		level = slog.LevelWarn
+	default:
+		level = slog.LevelInfo
+	}
+	attrs := []slog.Attr{
+		slog.String("code", st.Code().String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", st.Message()))
+	}
+	logger.LogAttrs(ctx, level, "rpc finished", attrs...)
+}
+
+// logError logs an error met while serving a request. Errors a status code already explains,
+// such as Scylla being unavailable or the deadline passing, are logged without a stack;
+// anything that would surface as Internal is a genuine internal error and is logged with one.
+func logError(ctx context.Context, msg string, err error, args ...any) {
+	switch status.Code(errorStatus(msg, err)) {
+	case codes.Internal, codes.Unknown:
+		logging.Internal(ctx, msg, err, args...)
+	default:
+		logging.FromContext(ctx).WarnContext(ctx, msg, append(args, slog.Any("error", err))...)
+	}
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// mapEntryPath is a parsed path to one map entry inside a column, such as bank.pages[3].items[12]
+type mapEntryPath struct {
+	column string
+	steps  []pathStep
+}
+
+// pathStep descends into a field, and into the entry at key if the field is a map
+type pathStep struct {
+	field  string
+	key    string
+	hasKey bool
+}
+
+// parseMapEntryPath splits a path into its column and the steps taken inside the column's message.
+// The last step must name a map entry.
+func parseMapEntryPath(path string) (mapEntryPath, error) {
+	segments := strings.Split(path, ".")
+	if len(segments) < 2 || segments[0] == "" {
+		return mapEntryPath{}, fmt.Errorf("path %q must start with a column and name a map entry, e.g. bank.pages[3]", path)
+	}
+	parsed := mapEntryPath{column: segments[0]}
+	for _, segment := range segments[1:] {
+		step := pathStep{field: segment}
+		if open := strings.IndexByte(segment, '['); open >= 0 {
+			if !strings.HasSuffix(segment, "]") || open == 0 {
+				return mapEntryPath{}, fmt.Errorf("path %q has a malformed segment %q", path, segment)
+			}
+			step = pathStep{field: segment[:open], key: segment[open+1 : len(segment)-1], hasKey: true}
+		}
+		parsed.steps = append(parsed.steps, step)
+	}
+	if !parsed.steps[len(parsed.steps)-1].hasKey {
+		return mapEntryPath{}, fmt.Errorf("path %q must end in a map entry, e.g. %s[key]", path, path)
+	}
+	return parsed, nil
+}
+
+// resolveMapEntry walks steps down from root to the map holding the entry named by the last step.
+// With create set, missing messages along the way are created in root;
+// otherwise a nil map is returned as soon as one is missing.
+func resolveMapEntry(
+	root protoreflect.Message,
+	steps []pathStep,
+	create bool,
+) (protoreflect.Map, protoreflect.MapKey, protoreflect.FieldDescriptor, error) {
+	msg := root
+	for i, step := range steps {
+		fd := msg.Descriptor().Fields().ByName(protoreflect.Name(step.field))
+		if fd == nil {
+			return nil, protoreflect.MapKey{}, nil, fmt.Errorf("%s has no field %s", msg.Descriptor().FullName(), step.field)
+		}
+
+		if !step.hasKey {
+			if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+				return nil, protoreflect.MapKey{}, nil, fmt.Errorf("field %s is not a singular message", fd.Name())
+			}
+			if create {
+				msg = msg.Mutable(fd).Message()
+			} else if msg.Has(fd) {
+				msg = msg.Get(fd).Message()
+			} else {
+				return nil, protoreflect.MapKey{}, nil, nil
+			}
+			continue
+		}
+
+		if !fd.IsMap() {
+			return nil, protoreflect.MapKey{}, nil, fmt.Errorf("field %s is not a map", fd.Name())
+		}
+		key, err := parseMapKey(fd.MapKey(), step.key)
+		if err != nil {
+			return nil, protoreflect.MapKey{}, nil, err
+		}
+		var m protoreflect.Map
+		if create {
+			m = msg.Mutable(fd).Map()
+		} else {
+			m = msg.Get(fd).Map()
+		}
+		if i == len(steps)-1 {
+			return m, key, fd, nil
+		}
+
+		if fd.MapValue().Message() == nil {
+			return nil, protoreflect.MapKey{}, nil, fmt.Errorf("map %s does not hold messages", fd.Name())
+		}
+		if create {
+			msg = m.Mutable(key).Message()
+		} else if m.Has(key) {
+			msg = m.Get(key).Message()
+		} else {
+			return nil, protoreflect.MapKey{}, nil, nil
+		}
+	}
+	// unreachable, since parseMapEntryPath requires the last step to have a key
+	return nil, protoreflect.MapKey{}, nil, fmt.Errorf("path does not end in a map entry")
+}
+
+// putMapEntry sets the map entry named by steps inside root to the encoded value,
+// creating the messages on the way that are missing.
+func putMapEntry(root protoreflect.Message, steps []pathStep, data []byte) error {
+	m, key, fd, err := resolveMapEntry(root, steps, true)
+	if err != nil {
+		return invalidArgument(err.Error(), "path")
+	}
+	value, err := decodeMapValue(fd, m, data)
+	if err != nil {
+		return invalidArgument(err.Error(), "value")
+	}
+	m.Set(key, value)
+	return nil
+}
+
+// removeMapEntry deletes the map entry named by steps inside root, and returns whether it was there.
+func removeMapEntry(root protoreflect.Message, steps []pathStep) (bool, error) {
+	m, key, _, err := resolveMapEntry(root, steps, false)
+	if err != nil {
+		return false, invalidArgument(err.Error(), "path")
+	}
+	if m == nil || !m.Has(key) {
+		return false, nil
+	}
+	// resolve again for writing; every message on the way exists, so nothing is created
+	m, key, _, _ = resolveMapEntry(root, steps, true)
+	m.Clear(key)
+	return true, nil
+}
+
+// parseMapKey converts the text between brackets into a key of the map's key type.
+func parseMapKey(fd protoreflect.FieldDescriptor, text string) (protoreflect.MapKey, error) {
+	var v protoreflect.Value
+	var err error
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(text)
+	case protoreflect.BoolKind:
+		var b bool
+		b, err = strconv.ParseBool(text)
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var i int64
+		i, err = strconv.ParseInt(text, 10, 32)
+		v = protoreflect.ValueOfInt32(int32(i))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var i int64
+		i, err = strconv.ParseInt(text, 10, 64)
+		v = protoreflect.ValueOfInt64(i)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var u uint64
+		u, err = strconv.ParseUint(text, 10, 32)
+		v = protoreflect.ValueOfUint32(uint32(u))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var u uint64
+		u, err = strconv.ParseUint(text, 10, 64)
+		v = protoreflect.ValueOfUint64(u)
+	default:
+		return protoreflect.MapKey{}, fmt.Errorf("map %s has unsupported key type %s", fd.Parent().Name(), fd.Kind())
+	}
+	if err != nil {
+		return protoreflect.MapKey{}, fmt.Errorf("invalid %s key %q: %w", fd.Kind(), text, err)
+	}
+	return v.MapKey(), nil
+}
+
+// decodeMapValue decodes a map value for the map field fd. Message values are serialized messages,
+// and string or bytes values are taken as is; maps of other scalars are not supported.
+func decodeMapValue(fd protoreflect.FieldDescriptor, m protoreflect.Map, data []byte) (protoreflect.Value, error) {
+	switch vd := fd.MapValue(); {
+	case vd.Message() != nil:
+		v := m.NewValue()
+		if err := proto.Unmarshal(data, v.Message().Interface()); err != nil {
+			return protoreflect.Value{}, fmt.Errorf("value is not a valid %s: %w", vd.Message().FullName(), err)
+		}
+		return v, nil
+	case vd.Kind() == protoreflect.StringKind:
+		return protoreflect.ValueOfString(string(data)), nil
+	case vd.Kind() == protoreflect.BytesKind:
+		return protoreflect.ValueOfBytes(data), nil
+	default:
+		return protoreflect.Value{}, fmt.Errorf("map %s has unsupported value type %s", fd.Name(), vd.Kind())
+	}
+}
+
+// encodeMapValue is the inverse of decodeMapValue.
+func encodeMapValue(fd protoreflect.FieldDescriptor, v protoreflect.Value) ([]byte, error) {
+	switch vd := fd.MapValue(); {
+	case vd.Message() != nil:
+		return proto.Marshal(v.Message().Interface())
+	case vd.Kind() == protoreflect.StringKind:
+		return []byte(v.String()), nil
+	case vd.Kind() == protoreflect.BytesKind:
+		return v.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("map %s has unsupported value type %s", fd.Name(), vd.Kind())
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/Runic-Studios/Trove/server/gen/api/schema/v1"
+	playersv1 "github.com/Runic-Studios/Trove/server/gen/api/schema/v1/player"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestParseMapEntryPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		path    string
+		want    mapEntryPath
+		wantErr string
+	}{
+		{
+			name: "map entry",
+			path: "bank.pages[3]",
+			want: mapEntryPath{column: "bank", steps: []pathStep{{field: "pages", key: "3", hasKey: true}}},
+		},
+		{
+			name: "nested map entry",
+			path: "bank.pages[3].items[12]",
+			want: mapEntryPath{column: "bank", steps: []pathStep{
+				{field: "pages", key: "3", hasKey: true},
+				{field: "items", key: "12", hasKey: true},
+			}},
+		},
+		{
+			name: "through a message field",
+			path: "bank.pages[3].items[12].data.customData[owner]",
+			want: mapEntryPath{column: "bank", steps: []pathStep{
+				{field: "pages", key: "3", hasKey: true},
+				{field: "items", key: "12", hasKey: true},
+				{field: "data"},
+				{field: "customData", key: "owner", hasKey: true},
+			}},
+		},
+		{
+			name: "empty key",
+			path: "settings.chatChannels[]",
+			want: mapEntryPath{column: "settings", steps: []pathStep{{field: "chatChannels", hasKey: true}}},
+		},
+		{
+			name:    "column only",
+			path:    "bank",
+			wantErr: "must start with a column",
+		},
+		{
+			name:    "missing column",
+			path:    ".pages[3]",
+			wantErr: "must start with a column",
+		},
+		{
+			name:    "unclosed bracket",
+			path:    "bank.pages[3",
+			wantErr: "has a malformed segment",
+		},
+		{
+			name:    "key without a field",
+			path:    "bank.[3]",
+			wantErr: "has a malformed segment",
+		},
+		{
+			name:    "ends in a field",
+			path:    "bank.pages[3].items",
+			wantErr: "must end in a map entry",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMapEntryPath(tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("parseMapEntryPath() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseMapEntryPath() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMapEntryPath() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustMarshal(t *testing.T, m proto.Message) []byte {
+	t.Helper()
+	data, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatalf("proto.Marshal() error = %v", err)
+	}
+	return data
+}
+
+func TestPutMapEntry(t *testing.T) {
+	sword := &v1.ItemDataStack{Data: &v1.ItemData{TemplateID: "sword"}, Count: 1}
+	arrows := &v1.ItemDataStack{Data: &v1.ItemData{TemplateID: "arrow"}, Count: 64}
+
+	tests := []struct {
+		name    string
+		bank    *playersv1.PlayerBankData
+		path    string
+		value   []byte
+		want    *playersv1.PlayerBankData
+		wantErr string
+	}{
+		{
+			name:  "creates the page",
+			bank:  &playersv1.PlayerBankData{MaxPageIndex: 2},
+			path:  "bank.pages[1].items[4]",
+			value: mustMarshal(t, sword),
+			want: &playersv1.PlayerBankData{MaxPageIndex: 2, Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{4: sword}},
+			}},
+		},
+		{
+			name: "replaces an entry and keeps its siblings",
+			bank: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{4: sword, 5: sword}},
+			}},
+			path:  "bank.pages[1].items[4]",
+			value: mustMarshal(t, arrows),
+			want: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{4: arrows, 5: sword}},
+			}},
+		},
+		{
+			name: "string value",
+			bank: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{4: sword}},
+			}},
+			path:  "bank.pages[1].items[4].data.customData[owner]",
+			value: []byte("Notch"),
+			want: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{4: {
+					Data:  &v1.ItemData{TemplateID: "sword", CustomData: map[string]string{"owner": "Notch"}},
+					Count: 1,
+				}}},
+			}},
+		},
+		{
+			name:    "unknown field",
+			bank:    &playersv1.PlayerBankData{},
+			path:    "bank.vaults[1]",
+			wantErr: "has no field vaults",
+		},
+		{
+			name:    "invalid key",
+			bank:    &playersv1.PlayerBankData{},
+			path:    "bank.pages[first]",
+			wantErr: "invalid int32 key",
+		},
+		{
+			name:    "key on a field that is not a map",
+			bank:    &playersv1.PlayerBankData{},
+			path:    "bank.maxPageIndex[1]",
+			wantErr: "field maxPageIndex is not a map",
+		},
+		{
+			name:    "invalid value",
+			bank:    &playersv1.PlayerBankData{},
+			path:    "bank.pages[1].items[4]",
+			value:   []byte{0xff},
+			wantErr: "value is not a valid schema.v1.ItemDataStack",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := parseMapEntryPath(tt.path)
+			if err != nil {
+				t.Fatalf("parseMapEntryPath() error = %v", err)
+			}
+			err = putMapEntry(tt.bank.ProtoReflect(), path.steps, tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("putMapEntry() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("putMapEntry() error = %v", err)
+			}
+			if !proto.Equal(tt.bank, tt.want) {
+				t.Errorf("putMapEntry() = %v, want %v", tt.bank, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveMapEntry(t *testing.T) {
+	sword := &v1.ItemDataStack{Data: &v1.ItemData{TemplateID: "sword"}, Count: 1}
+
+	tests := []struct {
+		name        string
+		bank        *playersv1.PlayerBankData
+		path        string
+		want        *playersv1.PlayerBankData
+		wantRemoved bool
+		wantErr     string
+	}{
+		{
+			name: "removes the entry and keeps its siblings",
+			bank: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{4: sword, 5: sword}},
+			}},
+			path: "bank.pages[1].items[4]",
+			want: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{5: sword}},
+			}},
+			wantRemoved: true,
+		},
+		{
+			name: "missing entry",
+			bank: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{5: sword}},
+			}},
+			path: "bank.pages[1].items[4]",
+			want: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{5: sword}},
+			}},
+		},
+		{
+			name: "missing page is not created",
+			bank: &playersv1.PlayerBankData{MaxPageIndex: 2},
+			path: "bank.pages[1].items[4]",
+			want: &playersv1.PlayerBankData{MaxPageIndex: 2},
+		},
+		{
+			name: "missing message field is not created",
+			bank: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{4: {Count: 1}}},
+			}},
+			path: "bank.pages[1].items[4].data.customData[owner]",
+			want: &playersv1.PlayerBankData{Pages: map[int32]*playersv1.PlayerBankData_BankPage{
+				1: {Items: map[int32]*v1.ItemDataStack{4: {Count: 1}}},
+			}},
+		},
+		{
+			name:    "invalid key",
+			bank:    &playersv1.PlayerBankData{},
+			path:    "bank.pages[first]",
+			wantErr: "invalid int32 key",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := parseMapEntryPath(tt.path)
+			if err != nil {
+				t.Fatalf("parseMapEntryPath() error = %v", err)
+			}
+			removed, err := removeMapEntry(tt.bank.ProtoReflect(), path.steps)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("removeMapEntry() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("removeMapEntry() error = %v", err)
+			}
+			if removed != tt.wantRemoved {
+				t.Errorf("removeMapEntry() removed = %t, want %t", removed, tt.wantRemoved)
+			}
+			if !proto.Equal(tt.bank, tt.want) {
+				t.Errorf("removeMapEntry() = %v, want %v", tt.bank, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,420 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/internal/db"
+	"github.com/gocql/gocql"
+	"golang.org/x/time/rate"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// migratorServerID is the lock owner used while the migrator rewrites a row
+	migratorServerID = "trove-migrator"
+	// migratorLeaseMillis is how long the migrator holds a player's lock for a single row
+	migratorLeaseMillis = 10_000
+	// migratorLockKey is the primary key column holding the user id that rows are locked by
+	migratorLockKey = "user_id"
+
+	// migratorRetryInterval is how long the migrator waits before retrying rows that were locked
+	migratorRetryInterval = 30 * time.Second
+
+	migrationTokenRanges     = 256
+	migrationPageSize        = 500
+	defaultMigrationRowsRate = 50
+)
+
+var (
+	// errRowLocked is returned by migrateRow when a game server holds the row's lock
+	errRowLocked = errors.New("row is locked by a game server")
+	// errRowUpToDate is returned by migrateRow when the row is already at the latest version
+	errRowUpToDate = errors.New("row is already at the latest version")
+)
+
+// MigrationStatus is a snapshot of a background migration job.
+type MigrationStatus struct {
+	Running    bool
+	Checkpoint db.MigrationCheckpoint
+	LastError  string
+}
+
+// migrationJob is a single background migration over one table.
+type migrationJob struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu         sync.Mutex
+	checkpoint db.MigrationCheckpoint
+	lastError  string
+}
+
+// Migrator eagerly transforms every row of a table up to the latest schema version,
+// so that old transformers can eventually be deleted.
+// Rows are scanned by token range, rewritten under the player's lock, and progress is
+// checkpointed after every range so that a stopped job resumes where it left off.
+// Every rewritten row is published as a "Migrate" change, so watchers see it like any other write.
+type Migrator struct {
+	session      *gocql.Session
+	transformers *TransformerChain
+	publish      func(operation, table string, superKeys map[string]string, data map[string][]byte, version string)
+
+	mu      sync.Mutex
+	jobs    map[string]*migrationJob
+	dryRuns map[string]*dryRunJob
+}
+
+// NewMigrator creates a migrator with no running jobs, reporting the rows it rewrites to publish.
+func NewMigrator(
+	session *gocql.Session,
+	transformers *TransformerChain,
+	publish func(operation, table string, superKeys map[string]string, data map[string][]byte, version string),
+) *Migrator {
+	return &Migrator{
+		session:      session,
+		transformers: transformers,
+		publish:      publish,
+		jobs:         make(map[string]*migrationJob),
+		dryRuns:      make(map[string]*dryRunJob),
+	}
+}
+
+// Start launches a background migration of table, resuming from its checkpoint unless restart is set.
+// rowsPerSecond limits how many rows are rewritten per second, defaulting when <= 0.
+func (m *Migrator) Start(ctx context.Context, table string, rowsPerSecond int, restart bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if job, ok := m.jobs[table]; ok {
+		select {
+		case <-job.done:
+		default:
+			return status.Errorf(codes.FailedPrecondition, "migration of %s is already running", table)
+		}
+	}
+
+	schema, err := db.LoadTableSchema(ctx, m.session, db.Keyspace(), table)
+	if err != nil {
+		return fmt.Errorf("failed to load schema of %s: %w", table, err)
+	}
+	if !slices.Contains(schema.PrimaryKeys(), migratorLockKey) {
+		return status.Errorf(codes.FailedPrecondition, "table %s has no %s key to lock rows by", table, migratorLockKey)
+	}
+	if len(schema.BlobColumns) == 0 {
+		return status.Errorf(codes.FailedPrecondition, "table %s has no blob columns to migrate", table)
+	}
+
+	checkpoint, err := db.LoadMigrationCheckpoint(ctx, m.session, table)
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint of %s: %w", table, err)
+	}
+	latest := m.transformers.LatestVersion
+	if restart || checkpoint == nil ||
+		checkpoint.TargetVersion != latest || checkpoint.TotalRanges != migrationTokenRanges {
+		checkpoint = &db.MigrationCheckpoint{
+			Table:         table,
+			TargetVersion: latest,
+			TotalRanges:   migrationTokenRanges,
+		}
+		if err := db.ClearMigrationPending(ctx, m.session, table); err != nil {
+			return fmt.Errorf("failed to clear pending rows of %s: %w", table, err)
+		}
+	}
+
+	if rowsPerSecond <= 0 {
+		rowsPerSecond = defaultMigrationRowsRate
+	}
+
+	// the job outlives the request that started it
+	jobCtx, cancel := context.WithCancel(context.Background())
+	job := &migrationJob{
+		cancel:     cancel,
+		done:       make(chan struct{}),
+		checkpoint: *checkpoint,
+	}
+	m.jobs[table] = job
+
+	go func() {
+		defer close(job.done)
+		err := m.run(jobCtx, job, schema, rowsPerSecond)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("migration stopped", slog.String("table", table), slog.Any("error", err))
+			job.mu.Lock()
+			job.lastError = err.Error()
+			job.mu.Unlock()
+		}
+	}()
+	return nil
+}
+
+// Stop cancels the running migration of table and waits for it to finish its current row;
+// it can later be resumed with Start.
+func (m *Migrator) Stop(ctx context.Context, table string) error {
+	m.mu.Lock()
+	job, ok := m.jobs[table]
+	m.mu.Unlock()
+	if !ok {
+		return status.Errorf(codes.NotFound, "no migration of %s has been started", table)
+	}
+	job.cancel()
+	select {
+	case <-job.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StopAll cancels every running migration and dry run, and waits for them to finish their current row.
+func (m *Migrator) StopAll() {
+	m.mu.Lock()
+	var jobs []*migrationJob
+	for _, job := range m.jobs {
+		jobs = append(jobs, job)
+	}
+	var dryRuns []*dryRunJob
+	for _, job := range m.dryRuns {
+		dryRuns = append(dryRuns, job)
+	}
+	m.mu.Unlock()
+
+	for _, job := range jobs {
+		job.cancel()
+		<-job.done
+	}
+	for _, job := range dryRuns {
+		job.cancel()
+		<-job.done
+	}
+}
+
+// Status reports the progress of the migration of table, falling back to its stored checkpoint
+// if no job has been started by this server.
+func (m *Migrator) Status(ctx context.Context, table string) (MigrationStatus, error) {
+	m.mu.Lock()
+	job, ok := m.jobs[table]
+	m.mu.Unlock()
+	if ok {
+		job.mu.Lock()
+		defer job.mu.Unlock()
+		running := true
+		select {
+		case <-job.done:
+			running = false
+		default:
+		}
+		return MigrationStatus{Running: running, Checkpoint: job.checkpoint, LastError: job.lastError}, nil
+	}
+
+	checkpoint, err := db.LoadMigrationCheckpoint(ctx, m.session, table)
+	if err != nil {
+		return MigrationStatus{}, err
+	}
+	if checkpoint == nil {
+		return MigrationStatus{Checkpoint: db.MigrationCheckpoint{Table: table}}, nil
+	}
+	return MigrationStatus{Checkpoint: *checkpoint}, nil
+}
+
+// RemainingByVersion counts the rows of table that are not yet at the latest schema version.
+func (m *Migrator) RemainingByVersion(ctx context.Context, table string) (map[string]int64, error) {
+	counts, err := db.CountVersions(ctx, m.session, table, migrationPageSize)
+	if err != nil {
+		return nil, err
+	}
+	delete(counts, m.transformers.LatestVersion)
+	return counts, nil
+}
+
+// run scans the remaining token ranges of the job, checkpointing after each one,
+// then retries the rows that were locked when scanned until every one of them is migrated.
+// Locked rows are kept in migration_pending, so that there is no bound on how many can wait.
+func (m *Migrator) run(ctx context.Context, job *migrationJob, schema db.TableSchema, rowsPerSecond int) error {
+	ranges := db.SplitTokenRing(migrationTokenRanges)
+	limiter := rate.NewLimiter(rate.Limit(rowsPerSecond), 1)
+
+	job.mu.Lock()
+	table := job.checkpoint.Table
+	next := job.checkpoint.NextRange
+	job.mu.Unlock()
+
+	for ; next < len(ranges); next++ {
+		err := db.ScanTokenRange(ctx, m.session, table, schema, nil, ranges[next], migrationPageSize,
+			func(row db.ScannedRow) error {
+				if row.SchemaVersion == m.transformers.LatestVersion {
+					return nil
+				}
+				if err := limiter.Wait(ctx); err != nil {
+					return err
+				}
+
+				err := m.migrateRow(ctx, table, schema, row.Keys)
+				if errors.Is(err, errRowLocked) {
+					if err := db.AddMigrationPending(ctx, m.session, table, row.Keys); err != nil {
+						return fmt.Errorf("failed to record locked row: %w", err)
+					}
+				}
+				job.mu.Lock()
+				job.record(table, row.Keys, err)
+				job.mu.Unlock()
+				return nil
+			})
+		if err != nil {
+			return err
+		}
+
+		job.mu.Lock()
+		job.checkpoint.NextRange = next + 1
+		job.mu.Unlock()
+		if err := m.saveCheckpoint(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	retry := time.NewTicker(migratorRetryInterval)
+	defer retry.Stop()
+	job.mu.Lock()
+	pending := job.checkpoint.Skipped > 0
+	job.mu.Unlock()
+	for pending {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-retry.C:
+		}
+
+		pending = false
+		err := db.ScanMigrationPending(ctx, m.session, table, migrationPageSize, func(keys map[string]string) error {
+			if err := limiter.Wait(ctx); err != nil {
+				return err
+			}
+			err := m.migrateRow(ctx, table, schema, keys)
+			job.mu.Lock()
+			job.checkpoint.Skipped--
+			job.record(table, keys, err)
+			job.mu.Unlock()
+			if errors.Is(err, errRowLocked) {
+				pending = true
+				return nil
+			}
+			return db.DeleteMigrationPending(ctx, m.session, table, keys)
+		})
+		if err != nil {
+			return err
+		}
+		if !pending {
+			// a row skipped again after a resume is counted twice but stored once
+			job.mu.Lock()
+			job.checkpoint.Skipped = 0
+			job.mu.Unlock()
+		}
+		if err := m.saveCheckpoint(ctx, job); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("migration complete", slog.String("table", table), slog.String("version", m.transformers.LatestVersion))
+	return nil
+}
+
+// record counts the outcome of migrating a row. The job's lock must be held.
+func (job *migrationJob) record(table string, keys map[string]string, err error) {
+	switch {
+	case errors.Is(err, errRowLocked):
+		job.checkpoint.Skipped++
+	case errors.Is(err, errRowUpToDate):
+	case err != nil:
+		slog.Warn("migration failed for row", slog.String("table", table), slog.Any("keys", keys), slog.Any("error", err))
+		job.checkpoint.Failed++
+	default:
+		job.checkpoint.Migrated++
+	}
+}
+
+// saveCheckpoint stores the job's progress.
+func (m *Migrator) saveCheckpoint(ctx context.Context, job *migrationJob) error {
+	job.mu.Lock()
+	job.checkpoint.UpdatedAt = time.Now()
+	checkpoint := job.checkpoint
+	job.mu.Unlock()
+	if err := db.SaveMigrationCheckpoint(ctx, m.session, &checkpoint); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// migrateRow claims the row's lock, re-reads and transforms it, writes it back and publishes the change.
+// It returns errRowLocked if the player is locked by a game server, and errRowUpToDate
+// if the row was already transformed since it was scanned.
+func (m *Migrator) migrateRow(ctx context.Context, table string, schema db.TableSchema, keys map[string]string) error {
+	userID := keys[migratorLockKey]
+	acquired, _, err := db.ClaimLock(ctx, m.session, userID, migratorServerID, migratorLeaseMillis)
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		return errRowLocked
+	}
+	defer func() {
+		releaseCtx, cancel := releaseContext(ctx)
+		defer cancel()
+		if _, err := db.ReleaseLock(releaseCtx, m.session, userID, migratorServerID); err != nil {
+			logError(releaseCtx, "error releasing migrator lock", err)
+		}
+	}()
+
+	up, err := transformRow(ctx, m.session, m.transformers, table, keys, schema.BlobColumns)
+	if err != nil {
+		return err
+	}
+	if up == nil {
+		return errRowUpToDate
+	}
+	m.publish("Migrate", table, keys, up, m.transformers.LatestVersion)
+	return nil
+}
+
+// transformRow re-reads a single row, transforms every given column up to the latest version,
+// and writes it back. The caller must hold the row's lock.
+// It returns the columns written, or nil without error if the row is already at the latest version.
+func transformRow(
+	ctx context.Context,
+	session *gocql.Session,
+	transformers *TransformerChain,
+	table string,
+	keys map[string]string,
+	columns []string,
+) (map[string][]byte, error) {
+	rows, err := db.LoadData(ctx, session, table, keys, columns)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) != 1 {
+		return nil, fmt.Errorf("expected 1 row, found %d", len(rows))
+	}
+
+	version := rows[0].SchemaVersion
+	latest := transformers.LatestVersion
+	if version == latest {
+		return nil, nil
+	}
+	up := make(map[string][]byte, len(rows[0].Data))
+	for column, datum := range rows[0].Data {
+		dataUp, err := transformers.TransformUp(table, column, version, datum)
+		if err != nil {
+			return nil, err
+		}
+		up[column] = dataUp
+	}
+	if err := db.SaveData(ctx, session, table, keys, up, latest); err != nil {
+		return nil, err
+	}
+	return up, nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// patchLockStripes is how many mutexes Patch spreads its rows over
+const patchLockStripes = 64
+
+// patchLock returns the mutex serialising patches of the row identified by rowKey on this server,
+// so that two patches of one row cannot both read the old blob and overwrite each other's fields.
+func (s *TroveServer) patchLock(table, rowKey string) *sync.Mutex {
+	h := fnv.New32a()
+	h.Write([]byte(table + "/" + rowKey))
+	return &s.patchLocks[h.Sum32()%patchLockStripes]
+}
+
+// mergeMasked copies every field named by paths from src onto dst.
+// A path names a field by its proto name, descending into singular message fields with dots.
+// A field that is unset in src is cleared in dst, so a mask can also be used to delete fields.
+func mergeMasked(dst, src protoreflect.Message, paths []string) error {
+	for _, path := range paths {
+		if err := mergePath(dst, src, strings.Split(path, ".")); err != nil {
+			return fmt.Errorf("invalid update_mask path %q: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func mergePath(dst, src protoreflect.Message, path []string) error {
+	fd := dst.Descriptor().Fields().ByName(protoreflect.Name(path[0]))
+	if fd == nil {
+		return fmt.Errorf("%s has no field %s", dst.Descriptor().FullName(), path[0])
+	}
+	if len(path) == 1 {
+		if src.Has(fd) {
+			dst.Set(fd, src.Get(fd))
+		} else {
+			dst.Clear(fd)
+		}
+		return nil
+	}
+	if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+		return fmt.Errorf("field %s is not a singular message and has no subfields", fd.Name())
+	}
+	if !src.Has(fd) && !dst.Has(fd) {
+		// nothing to copy and nothing to clear
+		return nil
+	}
+	return mergePath(dst.Mutable(fd).Message(), src.Get(fd).Message(), path[1:])
+}
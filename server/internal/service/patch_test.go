@@ -0,0 +1,125 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	v1 "github.com/Runic-Studios/Trove/server/gen/api/schema/v1"
+	characterv1 "github.com/Runic-Studios/Trove/server/gen/api/schema/v1/character"
+	playersv1 "github.com/Runic-Studios/Trove/server/gen/api/schema/v1/player"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestMergeMasked(t *testing.T) {
+	tests := []struct {
+		name    string
+		dst     proto.Message
+		src     proto.Message
+		paths   []string
+		want    proto.Message
+		wantErr string
+	}{
+		{
+			name:  "scalar field",
+			dst:   &characterv1.CharacterTraitsData{Level: 5, Exp: 10},
+			src:   &characterv1.CharacterTraitsData{Level: 7, Exp: 99},
+			paths: []string{"level"},
+			want:  &characterv1.CharacterTraitsData{Level: 7, Exp: 10},
+		},
+		{
+			name:  "several fields",
+			dst:   &characterv1.CharacterTraitsData{Level: 5, Exp: 10, Health: 20},
+			src:   &characterv1.CharacterTraitsData{Level: 7, Exp: 99, Health: 1},
+			paths: []string{"level", "exp"},
+			want:  &characterv1.CharacterTraitsData{Level: 7, Exp: 99, Health: 20},
+		},
+		{
+			name:  "field unset in the patch is cleared",
+			dst:   &characterv1.CharacterTraitsData{Level: 5, Outlaw: true},
+			src:   &characterv1.CharacterTraitsData{},
+			paths: []string{"outlaw"},
+			want:  &characterv1.CharacterTraitsData{Level: 5},
+		},
+		{
+			name:  "nested field",
+			dst:   &characterv1.CharacterTraitsData{Location: &v1.LocationData{X: 1, Y: 2}},
+			src:   &characterv1.CharacterTraitsData{Location: &v1.LocationData{X: 5, Y: 9}},
+			paths: []string{"location.x"},
+			want:  &characterv1.CharacterTraitsData{Location: &v1.LocationData{X: 5, Y: 2}},
+		},
+		{
+			name:  "nested field cleared when the patch lacks its parent",
+			dst:   &characterv1.CharacterTraitsData{Location: &v1.LocationData{X: 1, Y: 2}},
+			src:   &characterv1.CharacterTraitsData{},
+			paths: []string{"location.x"},
+			want:  &characterv1.CharacterTraitsData{Location: &v1.LocationData{Y: 2}},
+		},
+		{
+			name:  "nested field unset on both sides stays unset",
+			dst:   &characterv1.CharacterTraitsData{Level: 5},
+			src:   &characterv1.CharacterTraitsData{},
+			paths: []string{"location.x"},
+			want:  &characterv1.CharacterTraitsData{Level: 5},
+		},
+		{
+			name:  "whole message field is replaced",
+			dst:   &characterv1.CharacterTraitsData{Location: &v1.LocationData{X: 1, Y: 2}},
+			src:   &characterv1.CharacterTraitsData{Location: &v1.LocationData{Z: 3}},
+			paths: []string{"location"},
+			want:  &characterv1.CharacterTraitsData{Location: &v1.LocationData{Z: 3}},
+		},
+		{
+			name: "map field is replaced as a whole",
+			dst: &playersv1.PlayerSettingsData{Tips: true, ChatChannels: map[string]*playersv1.PlayerSettingsData_ChatChannelSettings{
+				"global": {Muted: true},
+				"trade":  {Spy: true},
+			}},
+			src: &playersv1.PlayerSettingsData{ChatChannels: map[string]*playersv1.PlayerSettingsData_ChatChannelSettings{
+				"global": {Muted: false, Spy: true},
+			}},
+			paths: []string{"chatChannels"},
+			want: &playersv1.PlayerSettingsData{Tips: true, ChatChannels: map[string]*playersv1.PlayerSettingsData_ChatChannelSettings{
+				"global": {Spy: true},
+			}},
+		},
+		{
+			name:    "unknown field",
+			dst:     &characterv1.CharacterTraitsData{},
+			src:     &characterv1.CharacterTraitsData{},
+			paths:   []string{"mana"},
+			wantErr: `invalid update_mask path "mana": schema.v1.character.CharacterTraitsData has no field mana`,
+		},
+		{
+			name:    "subfield of a scalar",
+			dst:     &characterv1.CharacterTraitsData{},
+			src:     &characterv1.CharacterTraitsData{},
+			paths:   []string{"level.x"},
+			wantErr: "field level is not a singular message",
+		},
+		{
+			name:    "subfield of a map",
+			dst:     &playersv1.PlayerSettingsData{},
+			src:     &playersv1.PlayerSettingsData{},
+			paths:   []string{"chatChannels.muted"},
+			wantErr: "field chatChannels is not a singular message",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mergeMasked(tt.dst.ProtoReflect(), tt.src.ProtoReflect(), tt.paths)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("mergeMasked() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mergeMasked() error = %v", err)
+			}
+			if !proto.Equal(tt.dst, tt.want) {
+				t.Errorf("mergeMasked() = %v, want %v", tt.dst, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/internal/db"
+	"github.com/gocql/gocql"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// quarantineServerID is the lock owner used while retrying a quarantined row
+	quarantineServerID = "trove-quarantine"
+	// quarantineLeaseMillis is how long a retry holds the player's lock
+	quarantineLeaseMillis = 10_000
+)
+
+// Fallback decides what Load returns for a column whose transform failed.
+type Fallback int
+
+const (
+	// FallbackFail fails the whole Load.
+	FallbackFail Fallback = iota
+	// FallbackRaw returns the untransformed blob, flagged as quarantined.
+	FallbackRaw
+	// FallbackDefault returns the column's default blob, flagged as quarantined.
+	FallbackDefault
+)
+
+// ParseFallback returns the fallback named "fail", "raw" or "default".
+func ParseFallback(name string) (Fallback, error) {
+	switch name {
+	case "fail":
+		return FallbackFail, nil
+	case "raw":
+		return FallbackRaw, nil
+	case "default":
+		return FallbackDefault, nil
+	}
+	return 0, fmt.Errorf("unknown fallback %q, must be fail, raw or default", name)
+}
+
+// QuarantinePolicy configures how failed transforms are handled during Load.
+type QuarantinePolicy struct {
+	// Fallback applies to every column without an entry in ColumnFallbacks.
+	Fallback Fallback
+	// ColumnFallbacks overrides Fallback per "table.column".
+	ColumnFallbacks map[string]Fallback
+	// Defaults holds the blob returned under FallbackDefault per "table.column".
+	// Columns without an entry return an empty blob, which decodes as an empty message.
+	Defaults map[string][]byte
+	// Alert is called when a column is first quarantined, if set. Later Loads of a column that is
+	// still quarantined do not call it again.
+	Alert func(q db.QuarantinedRow)
+}
+
+// fallbackFor returns the fallback configured for table.column.
+func (p QuarantinePolicy) fallbackFor(table, column string) Fallback {
+	if f, ok := p.ColumnFallbacks[table+"."+column]; ok {
+		return f
+	}
+	return p.Fallback
+}
+
+// Quarantine copies rows whose transform fails aside, so the player can still log in,
+// and lets an admin list and retry them once the transformer is fixed.
+type Quarantine struct {
+	session      *gocql.Session
+	transformers *TransformerChain
+	policy       QuarantinePolicy
+	// insert stores a quarantined column unless it is already quarantined, and returns whether it did
+	insert func(ctx context.Context, q db.QuarantinedRow) (bool, error)
+}
+
+// NewQuarantine creates a quarantine applying the given policy.
+func NewQuarantine(session *gocql.Session, transformers *TransformerChain, policy QuarantinePolicy) *Quarantine {
+	return &Quarantine{
+		session:      session,
+		transformers: transformers,
+		policy:       policy,
+		insert: func(ctx context.Context, q db.QuarantinedRow) (bool, error) {
+			return db.QuarantineRow(ctx, session, q)
+		},
+	}
+}
+
+// Add quarantines a column of the row with the given primary key that failed to transform with transformErr,
+// fires the alert hook if the column was not already quarantined, and returns the blob Load should return
+// in its place. Under FallbackFail it returns transformErr itself.
+func (q *Quarantine) Add(
+	ctx context.Context,
+	table string,
+	rowKey map[string]string,
+	column, version string,
+	original []byte,
+	transformErr error,
+) ([]byte, error) {
+	path, _ := q.transformers.findPath(version)
+	entry := db.QuarantinedRow{
+		Table:         table,
+		RowKey:        formatKeys(rowKey),
+		Column:        column,
+		SuperKeys:     rowKey,
+		SchemaVersion: version,
+		VersionPath:   path,
+		Original:      original,
+		Error:         transformErr.Error(),
+		QuarantinedAt: time.Now(),
+	}
+	added, err := q.insert(ctx, entry)
+	if err != nil {
+		// the original blob is still in its row, since nothing is written back for a quarantined row,
+		// so alert anyway rather than lose track of it
+		logError(ctx, "error quarantining column", err, slog.String("table", table), slog.String("column", column))
+	}
+	if (added || err != nil) && q.policy.Alert != nil {
+		q.policy.Alert(entry)
+	}
+	return q.Fallback(table, column, original, transformErr)
+}
+
+// Fallback returns the blob Load should return for a column that failed to transform with transformErr,
+// without quarantining it. Under FallbackFail it returns transformErr itself.
+func (q *Quarantine) Fallback(table, column string, original []byte, transformErr error) ([]byte, error) {
+	switch q.policy.fallbackFor(table, column) {
+	case FallbackRaw:
+		return original, nil
+	case FallbackDefault:
+		if def, ok := q.policy.Defaults[table+"."+column]; ok {
+			return def, nil
+		}
+		return []byte{}, nil
+	default:
+		return nil, transformErr
+	}
+}
+
+// List returns up to limit quarantined columns of table.
+func (q *Quarantine) List(ctx context.Context, table string, limit int) ([]db.QuarantinedRow, error) {
+	return db.ListQuarantined(ctx, q.session, table, "", limit)
+}
+
+// Retry re-runs the transformer chain over every quarantined column of one row, under the player's lock.
+// If the row is still at a column's quarantined version, the whole row is transformed and written back.
+// If it has since been saved at the latest version, the quarantined originals are transformed from
+// their own versions and restored over whatever fallback was saved in their place.
+// Resolved columns are removed from quarantine; it returns how many there were.
+func (q *Quarantine) Retry(ctx context.Context, table, rowKey string) (int, error) {
+	entries, err := db.ListQuarantined(ctx, q.session, table, rowKey, 0)
+	if err != nil {
+		return 0, err
+	}
+	if len(entries) == 0 {
+		return 0, status.Error(codes.NotFound, "no quarantined columns for this row")
+	}
+
+	superKeys := entries[0].SuperKeys
+	userID := superKeys[migratorLockKey]
+	if userID == "" {
+		return 0, status.Errorf(codes.FailedPrecondition, "quarantined row has no %s key to lock by", migratorLockKey)
+	}
+	acquired, _, err := db.ClaimLock(ctx, q.session, userID, quarantineServerID, quarantineLeaseMillis)
+	if err != nil {
+		return 0, err
+	}
+	if !acquired {
+		return 0, lockConflict(userID, "player is locked by another server, retry once they log out")
+	}
+	defer func() {
+		releaseCtx, cancel := releaseContext(ctx)
+		defer cancel()
+		if _, err := db.ReleaseLock(releaseCtx, q.session, userID, quarantineServerID); err != nil {
+			logError(releaseCtx, "error releasing quarantine lock", err)
+		}
+	}()
+
+	columns := make([]string, len(entries))
+	for i, entry := range entries {
+		columns[i] = entry.Column
+	}
+	rows, err := db.LoadData(ctx, q.session, table, superKeys, columns)
+	if err != nil {
+		return 0, err
+	}
+	if len(rows) != 1 {
+		return 0, fmt.Errorf("expected 1 row, found %d", len(rows))
+	}
+
+	// each column is resolved by its own quarantined version: columns quarantined at the version the row is
+	// still at are transformed with the whole row, while columns whose row has since been saved at the latest
+	// version have their originals transformed and restored
+	latest := q.transformers.LatestVersion
+	version := rows[0].SchemaVersion
+	up := make(map[string][]byte, len(entries))
+	transformWhole := false
+	for _, entry := range entries {
+		switch version {
+		case entry.SchemaVersion:
+			transformWhole = true
+		case latest:
+			dataUp, err := q.transformers.TransformUp(table, entry.Column, entry.SchemaVersion, entry.Original)
+			if err != nil {
+				return 0, fmt.Errorf("failed to transform quarantined column %s: %w", entry.Column, err)
+			}
+			up[entry.Column] = dataUp
+		default:
+			return 0, status.Errorf(codes.FailedPrecondition,
+				"row is at version %s, expected column %s's quarantined version %s or latest version %s",
+				version, entry.Column, entry.SchemaVersion, latest,
+			)
+		}
+	}
+	if transformWhole {
+		schema, err := db.LoadTableSchema(ctx, q.session, db.Keyspace(), table)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := transformRow(ctx, q.session, q.transformers, table, superKeys, schema.BlobColumns); err != nil {
+			return 0, err
+		}
+	}
+	if len(up) > 0 {
+		if err := db.SaveData(ctx, q.session, table, superKeys, up, latest); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, entry := range entries {
+		if err := db.DeleteQuarantined(ctx, q.session, table, entry.RowKey, entry.Column); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Runic-Studios/Trove/server/internal/db"
+)
+
+func TestTransformRowsQuarantinesEachRow(t *testing.T) {
+	const userID = "7f1c9a52-2d5e-4a8e-9c1b-3f2a6d8e4b10"
+	// a Load of characters by user_id alone returns every slot of the player
+	slot := func(n string, traits []byte) db.Row {
+		return db.Row{
+			Keys:          map[string]string{"user_id": userID, "slot": n},
+			Data:          map[string][]byte{"traits": traits},
+			SchemaVersion: "v1",
+		}
+	}
+	rows := []db.Row{slot("1", []byte("one")), slot("2", []byte("two")), slot("3", []byte("three"))}
+
+	tests := []struct {
+		name     string
+		fallback Fallback
+		readOnly bool
+		wantErr  string
+		// wantRowKeys are the rows quarantined, in order
+		wantRowKeys []string
+	}{
+		{
+			name:     "raw fallback quarantines every slot",
+			fallback: FallbackRaw,
+			wantRowKeys: []string{
+				"slot=1, user_id=" + userID,
+				"slot=2, user_id=" + userID,
+				"slot=3, user_id=" + userID,
+			},
+		},
+		{
+			name:     "read-only callers get the fallback without quarantining",
+			fallback: FallbackRaw,
+			readOnly: true,
+		},
+		{
+			name:        "fail fallback stops at the first slot",
+			fallback:    FallbackFail,
+			wantErr:     "failed to transform column traits",
+			wantRowKeys: []string{"slot=1, user_id=" + userID},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transformers := &TransformerChain{
+				LatestVersion: "v2",
+				Links: map[VersionPair]TransformerFunc{{"v1", "v2"}: func(_, _ string, _ []byte) ([]byte, error) {
+					return nil, errors.New("traits are corrupt")
+				}},
+			}
+			if err := transformers.Validate(); err != nil {
+				t.Fatal(err)
+			}
+
+			stored := map[string]db.QuarantinedRow{}
+			var inserted []db.QuarantinedRow
+			alerts := 0
+			s := &TroveServer{
+				transformers: transformers,
+				quarantine: &Quarantine{
+					transformers: transformers,
+					policy: QuarantinePolicy{
+						Fallback: tt.fallback,
+						Alert:    func(db.QuarantinedRow) { alerts++ },
+					},
+					// like IF NOT EXISTS, keyed by the primary key of quarantined_rows
+					insert: func(_ context.Context, q db.QuarantinedRow) (bool, error) {
+						key := q.Table + "/" + q.RowKey + "/" + q.Column
+						if _, ok := stored[key]; ok {
+							return false, nil
+						}
+						stored[key] = q
+						inserted = append(inserted, q)
+						return true, nil
+					},
+				},
+			}
+
+			// a second Load of the same rows quarantines and alerts nothing more
+			for range 2 {
+				resp, err := s.transformRows(context.Background(), "characters", rows, false, !tt.readOnly)
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("transformRows() error = %v, want it to contain %q", err, tt.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("transformRows() error = %v", err)
+				}
+				for i, row := range resp {
+					if !bytes.Equal(row.GetColumnData()["traits"], rows[i].Data["traits"]) {
+						t.Errorf("row %d traits = %q, want the raw blob %q", i, row.GetColumnData()["traits"], rows[i].Data["traits"])
+					}
+					if !slices.Equal(row.GetQuarantinedColumns(), []string{"traits"}) {
+						t.Errorf("row %d quarantined columns = %v, want [traits]", i, row.GetQuarantinedColumns())
+					}
+				}
+			}
+
+			var gotRowKeys []string
+			for i, q := range inserted {
+				gotRowKeys = append(gotRowKeys, q.RowKey)
+				if !maps.Equal(q.SuperKeys, rows[i].Keys) {
+					t.Errorf("entry %d super keys = %v, want the row's primary key %v", i, q.SuperKeys, rows[i].Keys)
+				}
+				if !bytes.Equal(q.Original, rows[i].Data["traits"]) {
+					t.Errorf("entry %d original = %q, want %q", i, q.Original, rows[i].Data["traits"])
+				}
+			}
+			if !slices.Equal(gotRowKeys, tt.wantRowKeys) {
+				t.Errorf("quarantined rows = %v, want %v", gotRowKeys, tt.wantRowKeys)
+			}
+			if alerts != len(tt.wantRowKeys) {
+				t.Errorf("alerts = %d, want %d", alerts, len(tt.wantRowKeys))
+			}
+		})
+	}
+}
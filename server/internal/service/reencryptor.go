@@ -0,0 +1,76 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/internal/db"
+	"github.com/Runic-Studios/Trove/server/internal/logging"
+	"github.com/Runic-Studios/Trove/server/internal/metrics"
+	"github.com/gocql/gocql"
+)
+
+// Reencryptor re-seals the blobs of encrypted columns that are sealed with an older key, or were stored
+// before their column was encrypted, with the keyring's primary key. Once a pass has finished after a
+// rotation, the old key can be dropped from the keyring.
+type Reencryptor struct {
+	session  *gocql.Session
+	columns  []string
+	interval time.Duration
+}
+
+// NewReencryptor creates a re-encryptor of the given "table.column"s, making a pass every interval.
+func NewReencryptor(session *gocql.Session, columns []string, interval time.Duration) *Reencryptor {
+	return &Reencryptor{session: session, columns: columns, interval: interval}
+}
+
+// Run makes a pass over every column at once, then every interval, until ctx is done.
+func (r *Reencryptor) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		for _, column := range r.columns {
+			if ctx.Err() != nil {
+				return
+			}
+			r.reencrypt(ctx, column)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reencrypt scans a whole column by token range, re-sealing its outdated blobs.
+func (r *Reencryptor) reencrypt(ctx context.Context, tableColumn string) {
+	table, column, _ := strings.Cut(tableColumn, ".")
+	logger := logging.FromContext(ctx).With(slog.String("table", table), slog.String("column", column))
+	ctx = logging.WithLogger(ctx, logger)
+
+	schema, err := db.LoadTableSchema(ctx, r.session, db.Keyspace(), table)
+	if err != nil {
+		logError(ctx, "error loading table schema for re-encryption", err)
+		return
+	}
+
+	start := time.Now()
+	var rewritten int64
+	for _, tokenRange := range db.SplitTokenRing(migrationTokenRanges) {
+		n, err := db.ReencryptRange(ctx, r.session, table, schema, column, tokenRange, migrationPageSize)
+		rewritten += n
+		metrics.ReencryptedBlobs.WithLabelValues(table, column).Add(float64(n))
+		if err != nil {
+			if ctx.Err() == nil {
+				logError(ctx, "error re-encrypting column", err, slog.Int64("rewritten", rewritten))
+			}
+			return
+		}
+	}
+	logger.InfoContext(ctx, "re-encrypted column",
+		slog.Int64("rewritten", rewritten), slog.Duration("duration", time.Since(start)))
+}
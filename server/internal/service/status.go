@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/internal/db"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// StatusErrorsHeader is the metadata key a client sets to "true" to receive failures as gRPC status errors.
+// Without it, failures are returned the deprecated way: a nil error with success=false and error_message,
+// which handlers keep populating until every client has moved over.
+const StatusErrorsHeader = "trove-status-errors"
+
+// errorDomain is the ErrorInfo domain of every error reason returned by this server
+const errorDomain = "trove.runicrealms.com"
+
+// Error reasons carried in ErrorInfo details
+const (
+	reasonLockHeld    = "LOCK_HELD"
+	reasonUnavailable = "SCYLLA_UNAVAILABLE"
+	reasonInternal    = "INTERNAL"
+	reasonRateLimited = "RATE_LIMITED"
+	reasonTooLarge    = "REQUEST_TOO_LARGE"
+)
+
+// unavailableRetryDelay is the RetryInfo delay suggested when Scylla cannot be reached
+const unavailableRetryDelay = time.Second
+
+// UnaryStatusInterceptor returns handler failures as gRPC status errors to clients that opted in
+// through StatusErrorsHeader, and as the handler's success=false response to everyone else.
+func UnaryStatusInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err == nil {
+		return resp, nil
+	}
+	if wantsStatusErrors(ctx) || resp == nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func wantsStatusErrors(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	values := md.Get(StatusErrorsHeader)
+	return len(values) > 0 && values[0] == "true"
+}
+
+// statusError builds a status error with the given code, message and typed details.
+func statusError(code codes.Code, msg string, details ...protoadapt.MessageV1) error {
+	st := status.New(code, msg)
+	if len(details) > 0 {
+		if withDetails, err := st.WithDetails(details...); err == nil {
+			st = withDetails
+		}
+	}
+	return st.Err()
+}
+
+// invalidArgument reports a malformed request, listing the offending fields.
+func invalidArgument(msg string, fields ...string) error {
+	violations := make([]*errdetails.BadRequest_FieldViolation, len(fields))
+	for i, field := range fields {
+		violations[i] = &errdetails.BadRequest_FieldViolation{Field: field, Description: msg}
+	}
+	return statusError(codes.InvalidArgument, msg, &errdetails.BadRequest{FieldViolations: violations})
+}
+
+// lockNotHeld reports a request made without holding a valid lock on the player.
+func lockNotHeld(userID, msg string) error {
+	return statusError(codes.FailedPrecondition, msg, &errdetails.PreconditionFailure{
+		Violations: []*errdetails.PreconditionFailure_Violation{{
+			Type:        "LOCK",
+			Subject:     userID,
+			Description: msg,
+		}},
+	})
+}
+
+// lockConflict reports that another server holds the player's lock.
+func lockConflict(userID, msg string) error {
+	return statusError(codes.Aborted, msg, &errdetails.ErrorInfo{
+		Reason:   reasonLockHeld,
+		Domain:   errorDomain,
+		Metadata: map[string]string{"user_id": userID},
+	})
+}
+
+// errorStatus classifies an error from the db layer or a service component into a status with message msg.
+// Errors that already carry a status keep their code.
+func errorStatus(msg string, err error) error {
+	if st, ok := status.FromError(err); ok && st.Code() != codes.Unknown {
+		sp := st.Proto()
+		sp.Message = msg
+		return status.FromProto(sp).Err()
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return statusError(codes.DeadlineExceeded, msg)
+	case errors.Is(err, context.Canceled):
+		return statusError(codes.Canceled, msg)
+	case errors.Is(err, db.ErrInvalidRequest):
+		return invalidArgument(msg)
+	case db.IsUnavailable(err):
+		return statusError(codes.Unavailable, msg,
+			&errdetails.ErrorInfo{Reason: reasonUnavailable, Domain: errorDomain},
+			&errdetails.RetryInfo{RetryDelay: durationpb.New(unavailableRetryDelay)},
+		)
+	default:
+		return statusError(codes.Internal, msg, &errdetails.ErrorInfo{Reason: reasonInternal, Domain: errorDomain})
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryStatusInterceptor(t *testing.T) {
+	failed := &trove.SaveResponse{Success: false, ErrorMessage: "no lock held for this player"}
+	lockErr := lockNotHeld("7f1c9a52-2d5e-4a8e-9c1b-3f2a6d8e4b10", "no lock held for this player")
+	ok := &trove.SaveResponse{Success: true}
+
+	tests := []struct {
+		name     string
+		header   []string
+		resp     interface{}
+		err      error
+		wantResp interface{}
+		wantCode codes.Code
+	}{
+		{
+			name:     "legacy client gets the failed response",
+			resp:     failed,
+			err:      lockErr,
+			wantResp: failed,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "opted in client gets the status",
+			header:   []string{StatusErrorsHeader, "true"},
+			resp:     failed,
+			err:      lockErr,
+			wantCode: codes.FailedPrecondition,
+		},
+		{
+			name:     "header set to anything but true is legacy",
+			header:   []string{StatusErrorsHeader, "yes"},
+			resp:     failed,
+			err:      lockErr,
+			wantResp: failed,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "legacy client gets the status without a response",
+			err:      status.Error(codes.ResourceExhausted, "rate limit exceeded"),
+			wantCode: codes.ResourceExhausted,
+		},
+		{
+			name:     "legacy client success",
+			resp:     ok,
+			wantResp: ok,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "opted in client success",
+			header:   []string{StatusErrorsHeader, "true"},
+			resp:     ok,
+			wantResp: ok,
+			wantCode: codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.header != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(tt.header...))
+			}
+			handler := func(context.Context, interface{}) (interface{}, error) {
+				return tt.resp, tt.err
+			}
+			info := &grpc.UnaryServerInfo{FullMethod: trove.TroveService_Save_FullMethodName}
+
+			resp, err := UnaryStatusInterceptor(ctx, &trove.SaveRequest{}, info, handler)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("code = %s, want %s", code, tt.wantCode)
+			}
+			if resp != tt.wantResp {
+				t.Errorf("resp = %v, want %v", resp, tt.wantResp)
+			}
+		})
+	}
+}
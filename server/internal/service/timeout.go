@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"google.golang.org/grpc"
+)
+
+const (
+	// defaultRPCTimeout applies to any RPC without an entry in rpcTimeouts
+	defaultRPCTimeout = 30 * time.Second
+	// lockReleaseTimeout bounds releasing a lock after the request that claimed it has ended
+	lockReleaseTimeout = 5 * time.Second
+)
+
+// rpcTimeouts is the deadline given to each RPC whose client did not set one.
+// Scans of a whole table get far longer than the per-player calls made on the game's hot path.
+var rpcTimeouts = map[string]time.Duration{
+	trove.TroveService_ClaimLock_FullMethodName:        5 * time.Second,
+	trove.TroveService_ReleaseLock_FullMethodName:      5 * time.Second,
+	trove.TroveService_Exists_FullMethodName:           10 * time.Second,
+	trove.TroveService_Save_FullMethodName:             10 * time.Second,
+	trove.TroveService_Patch_FullMethodName:            10 * time.Second,
+	trove.TroveService_GetMapEntry_FullMethodName:      10 * time.Second,
+	trove.TroveService_PutMapEntry_FullMethodName:      10 * time.Second,
+	trove.TroveService_RemoveMapEntry_FullMethodName:   10 * time.Second,
+	trove.TroveService_Load_FullMethodName:             10 * time.Second,
+	trove.TroveService_PublicLoad_FullMethodName:       10 * time.Second,
+	trove.TroveService_SendMail_FullMethodName:         10 * time.Second,
+	trove.TroveService_ClaimMail_FullMethodName:        10 * time.Second,
+	trove.TroveService_BatchLoad_FullMethodName:        30 * time.Second,
+	trove.TroveService_MigrationStatus_FullMethodName:  5 * time.Minute,
+	trove.TroveService_RetryQuarantined_FullMethodName: time.Minute,
+}
+
+// UnaryTimeoutInterceptor gives every RPC a default deadline unless the client already set one,
+// so that abandoned requests do not leave queries running against Scylla.
+func UnaryTimeoutInterceptor(
+	ctx context.Context,
+	req interface{},
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if _, ok := ctx.Deadline(); ok {
+		return handler(ctx, req)
+	}
+	timeout, ok := rpcTimeouts[info.FullMethod]
+	if !ok {
+		timeout = defaultRPCTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return handler(ctx, req)
+}
+
+// releaseContext detaches a lock release from ctx, so that a lock claimed during a request
+// is still released when that request has been cancelled or has run out of time.
+func releaseContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), lockReleaseTimeout)
+}
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+
+	"github.com/Runic-Studios/Trove/server/gen/api/trove"
+	"github.com/Runic-Studios/Trove/server/internal/db"
+	"github.com/Runic-Studios/Trove/server/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// Request fields shared by many request messages, through their generated getters
+type (
+	lockedRequest interface{ GetLock() *trove.LockInfo }
+	userRequest   interface{ GetUserId() string }
+	serverRequest interface{ GetServerId() string }
+	tableRequest  interface{ GetTable() string }
+)
+
+// requestFields returns the table, user and server a request is about, each empty if it has none.
+func requestFields(req interface{}) (table, userID, serverID string) {
+	if r, ok := req.(tableRequest); ok {
+		table = r.GetTable()
+	}
+	if r, ok := req.(lockedRequest); ok && r.GetLock() != nil {
+		userID, serverID = r.GetLock().GetUserId(), r.GetLock().GetServerId()
+	}
+	if r, ok := req.(userRequest); ok && r.GetUserId() != "" {
+		userID = r.GetUserId()
+	}
+	if r, ok := req.(serverRequest); ok && r.GetServerId() != "" {
+		serverID = r.GetServerId()
+	}
+	return table, userID, serverID
+}
+
+// requestAttributes returns the table, user and server a request is about, for whichever of them it has.
+func requestAttributes(req interface{}) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	table, userID, serverID := requestFields(req)
+	if table != "" {
+		attrs = append(attrs, attribute.String("trove.table", table))
+	}
+	if userID != "" {
+		attrs = append(attrs, attribute.String("trove.user_id", userID))
+	}
+	if serverID != "" {
+		attrs = append(attrs, attribute.String("trove.server_id", serverID))
+	}
+	return attrs
+}
+
+// UnaryTracingInterceptor tags the RPC's span, started by the otelgrpc stats handler,
+// with the table, user and server of the request.
+func UnaryTracingInterceptor(
+	ctx context.Context,
+	req interface{},
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (interface{}, error) {
+	trace.SpanFromContext(ctx).SetAttributes(requestAttributes(req)...)
+	return handler(ctx, req)
+}
+
+// loadData is db.LoadData under a span of its own, apart from the transforms that follow it.
+func (s *TroveServer) loadData(
+	ctx context.Context,
+	table string,
+	superKeys map[string]string,
+	columns []string,
+) ([]db.Row, error) {
+	ctx, span := tracing.Tracer.Start(ctx, "LoadData", trace.WithAttributes(attribute.String("trove.table", table)))
+	defer span.End()
+	rows, err := db.LoadData(ctx, s.session, table, superKeys, columns)
+	if err != nil {
+		tracing.Fail(span, err)
+	}
+	return rows, err
+}
+
+// transformUp is TransformerChain.TransformUp under a span tagged with the column and the versions it crosses.
+func (s *TroveServer) transformUp(ctx context.Context, table, column, fromVer string, data []byte) ([]byte, error) {
+	hops := 0
+	if path, err := s.transformers.findPath(fromVer); err == nil {
+		hops = len(path) - 1
+	}
+	_, span := tracing.Tracer.Start(ctx, "TransformUp", trace.WithAttributes(
+		attribute.String("trove.table", table),
+		attribute.String("trove.column", column),
+	))
+	span.SetAttributes(tracing.VersionAttributes(fromVer, s.transformers.LatestVersion, hops)...)
+	defer span.End()
+	out, err := s.transformers.TransformUp(table, column, fromVer, data)
+	if err != nil {
+		tracing.Fail(span, err)
+	}
+	return out, err
+}
@@ -3,6 +3,13 @@ package service
 import (
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Runic-Studios/Trove/server/internal/metrics"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // TransformerFunc transforms the blob for a specific table & column,
@@ -19,6 +26,97 @@ type VersionPair struct {
 type TransformerChain struct {
 	LatestVersion string
 	Links         map[VersionPair]TransformerFunc
+	// ColumnTypes maps "table.column" to the message type stored in that column at LatestVersion.
+	// Columns without an entry are treated as opaque blobs.
+	ColumnTypes map[string]protoreflect.MessageType
+
+	// paths caches the resolved version-chain from every known version to LatestVersion.
+	// It is populated by Validate.
+	paths map[string][]string
+}
+
+// Validate checks that the chain is well-formed and caches the resolved paths.
+// Every version must be comparable, every link must go from an older to a newer version,
+// the links must not form a cycle, and every known version must reach LatestVersion
+// through exactly one path.
+// It must be called before TransformUp, and the server refuses to start if it fails.
+func (t *TransformerChain) Validate() error {
+	if _, err := parseVersion(t.LatestVersion); err != nil {
+		return fmt.Errorf("invalid latest version: %w", err)
+	}
+
+	graph := make(map[string][]string)
+	versions := map[string]bool{t.LatestVersion: true}
+	for vp := range t.Links {
+		if _, err := parseVersion(vp.From); err != nil {
+			return fmt.Errorf("invalid link %s → %s: %w", vp.From, vp.To, err)
+		}
+		if _, err := parseVersion(vp.To); err != nil {
+			return fmt.Errorf("invalid link %s → %s: %w", vp.From, vp.To, err)
+		}
+		if t.Links[vp] == nil {
+			return fmt.Errorf("invalid link %s → %s: transformer is nil", vp.From, vp.To)
+		}
+		graph[vp.From] = append(graph[vp.From], vp.To)
+		versions[vp.From] = true
+		versions[vp.To] = true
+	}
+	sorted := make([]string, 0, len(versions))
+	for version := range versions {
+		sorted = append(sorted, version)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return compareVersions(sorted[i], sorted[j]) < 0 })
+	for i := 1; i < len(sorted); i++ {
+		if compareVersions(sorted[i-1], sorted[i]) == 0 {
+			return fmt.Errorf("versions %s and %s are ambiguous, they compare as equal", sorted[i-1], sorted[i])
+		}
+	}
+
+	if len(graph[t.LatestVersion]) > 0 {
+		return fmt.Errorf("latest version %s must not have outgoing links", t.LatestVersion)
+	}
+
+	if cycle := findCycle(graph); cycle != nil {
+		return fmt.Errorf("transformer chain contains a cycle: %s", strings.Join(cycle, " → "))
+	}
+
+	for vp := range t.Links {
+		if compareVersions(vp.From, vp.To) >= 0 {
+			return fmt.Errorf("invalid link %s → %s: links must upgrade to a newer version", vp.From, vp.To)
+		}
+		if compareVersions(vp.To, t.LatestVersion) > 0 {
+			return fmt.Errorf("invalid link %s → %s: target is newer than latest version %s", vp.From, vp.To, t.LatestVersion)
+		}
+	}
+
+	paths := make(map[string][]string, len(versions))
+	for version := range versions {
+		found := allPaths(graph, version, t.LatestVersion)
+		switch {
+		case len(found) == 0:
+			return fmt.Errorf("version %s cannot reach latest version %s", version, t.LatestVersion)
+		case len(found) > 1:
+			options := make([]string, len(found))
+			for i, p := range found {
+				options[i] = strings.Join(p, " → ")
+			}
+			sort.Strings(options)
+			return fmt.Errorf(
+				"version %s has ambiguous paths to latest version %s: %s",
+				version, t.LatestVersion, strings.Join(options, "; "),
+			)
+		}
+		paths[version] = found[0]
+	}
+
+	t.paths = paths
+	return nil
+}
+
+// ColumnType returns the message type stored in table.column at LatestVersion, if it is known.
+func (t *TransformerChain) ColumnType(table, column string) (protoreflect.MessageType, bool) {
+	mt, ok := t.ColumnTypes[table+"."+column]
+	return mt, ok
 }
 
 // TransformUp migrates the given table.column blob from `fromVer` all the way to LatestVersion.
@@ -27,7 +125,7 @@ func (t *TransformerChain) TransformUp(
 	data []byte,
 ) ([]byte, error) {
 	// figure out the version‑chain: [fromVer, v2, v3, ..., LatestVersion]
-	path, err := t.findPath(fromVer, t.LatestVersion)
+	path, err := t.findPath(fromVer)
 	if err != nil {
 		return nil, err
 	}
@@ -42,8 +140,11 @@ func (t *TransformerChain) TransformUp(
 				table, column, step.From, step.To,
 			)
 		}
+		start := time.Now()
 		out, err = fn(table, column, out)
+		metrics.TransformDuration.WithLabelValues(table, column, step.From, step.To).Observe(time.Since(start).Seconds())
 		if err != nil {
+			metrics.TransformFailures.WithLabelValues(table, column, step.From, step.To).Inc()
 			return nil, fmt.Errorf(
 				"error transforming %s.%s %s → %s: %w",
 				table, column, step.From, step.To, err,
@@ -53,38 +154,111 @@ func (t *TransformerChain) TransformUp(
 	return out, nil
 }
 
-// findPath does a simple BFS only over version strings to discover a path.
-func (t *TransformerChain) findPath(from, to string) ([]string, error) {
-	graph := make(map[string][]string)
-	for vp := range t.Links {
-		graph[vp.From] = append(graph[vp.From], vp.To)
+// findPath looks up the precomputed version-chain from `from` to LatestVersion.
+func (t *TransformerChain) findPath(from string) ([]string, error) {
+	if t.paths == nil {
+		return nil, errors.New("transformer chain has not been validated")
+	}
+	path, ok := t.paths[from]
+	if !ok {
+		return nil, errors.New("no path found from " + from + " to " + t.LatestVersion)
 	}
+	return path, nil
+}
+
+// findCycle returns the versions forming a cycle in the graph, or nil if it is acyclic.
+func findCycle(graph map[string][]string) []string {
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make(map[string]int)
+	var stack []string
 
-	type state struct {
-		version string
-		path    []string
+	var visit func(version string) []string
+	visit = func(version string) []string {
+		state[version] = visiting
+		stack = append(stack, version)
+		for _, next := range graph[version] {
+			switch state[next] {
+			case visiting:
+				for i, v := range stack {
+					if v == next {
+						return append(append([]string{}, stack[i:]...), next)
+					}
+				}
+			case unvisited:
+				if cycle := visit(next); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[version] = done
+		return nil
 	}
-	queue := []state{{from, []string{from}}}
-	visited := map[string]bool{}
 
-	for len(queue) > 0 {
-		cur := queue[0]
-		queue = queue[1:]
+	for version := range graph {
+		if state[version] == unvisited {
+			if cycle := visit(version); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
 
-		if cur.version == to {
-			return cur.path, nil
+// allPaths enumerates every path from `from` to `to` in an acyclic graph.
+func allPaths(graph map[string][]string, from, to string) [][]string {
+	if from == to {
+		return [][]string{{to}}
+	}
+	var paths [][]string
+	for _, next := range graph[from] {
+		for _, rest := range allPaths(graph, next, to) {
+			paths = append(paths, append([]string{from}, rest...))
 		}
-		if visited[cur.version] {
-			continue
+	}
+	return paths
+}
+
+// parseVersion parses a version string of the form "v1", "v2", "v2.1", ... into its numeric parts.
+func parseVersion(version string) ([]int, error) {
+	if !strings.HasPrefix(version, "v") || len(version) == 1 {
+		return nil, fmt.Errorf("version %q must be of the form v<major>[.<minor>...]", version)
+	}
+	parts := strings.Split(version[1:], ".")
+	nums := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("version %q must be of the form v<major>[.<minor>...]", version)
 		}
-		visited[cur.version] = true
+		nums[i] = n
+	}
+	return nums, nil
+}
 
-		for _, next := range graph[cur.version] {
-			if !visited[next] {
-				queue = append(queue, state{next, append(cur.path, next)})
+// compareVersions returns -1, 0 or 1 if a is older than, equal to or newer than b.
+// Both versions must already have been checked with parseVersion.
+func compareVersions(a, b string) int {
+	pa, _ := parseVersion(a)
+	pb, _ := parseVersion(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
 			}
+			return 1
 		}
 	}
-
-	return nil, errors.New("no path found from " + from + " to " + to)
+	return 0
 }
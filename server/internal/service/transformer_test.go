@@ -0,0 +1,132 @@
+package service
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func identity(_, _ string, data []byte) ([]byte, error) {
+	return data, nil
+}
+
+func chain(latest string, links ...VersionPair) *TransformerChain {
+	t := &TransformerChain{LatestVersion: latest, Links: make(map[VersionPair]TransformerFunc, len(links))}
+	for _, link := range links {
+		t.Links[link] = identity
+	}
+	return t
+}
+
+func TestTransformerChainValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		chain   *TransformerChain
+		wantErr string
+		paths   map[string][]string
+	}{
+		{
+			name:  "latest only",
+			chain: chain("v1"),
+			paths: map[string][]string{"v1": {"v1"}},
+		},
+		{
+			name:  "linear chain",
+			chain: chain("v3", VersionPair{"v1", "v2"}, VersionPair{"v2", "v3"}),
+			paths: map[string][]string{
+				"v1": {"v1", "v2", "v3"},
+				"v2": {"v2", "v3"},
+				"v3": {"v3"},
+			},
+		},
+		{
+			name:  "minor versions",
+			chain: chain("v2", VersionPair{"v1", "v1.1"}, VersionPair{"v1.1", "v2"}),
+			paths: map[string][]string{"v1": {"v1", "v1.1", "v2"}},
+		},
+		{
+			name:    "invalid latest version",
+			chain:   chain("3"),
+			wantErr: "invalid latest version",
+		},
+		{
+			name:    "invalid link version",
+			chain:   chain("v2", VersionPair{"one", "v2"}),
+			wantErr: "invalid link one → v2",
+		},
+		{
+			name: "nil transformer",
+			chain: &TransformerChain{
+				LatestVersion: "v2",
+				Links:         map[VersionPair]TransformerFunc{{"v1", "v2"}: nil},
+			},
+			wantErr: "transformer is nil",
+		},
+		{
+			name:    "versions comparing as equal",
+			chain:   chain("v2", VersionPair{"v1", "v2"}, VersionPair{"v1.0", "v2"}),
+			wantErr: "ambiguous, they compare as equal",
+		},
+		{
+			name:    "latest version with outgoing link",
+			chain:   chain("v2", VersionPair{"v1", "v2"}, VersionPair{"v2", "v3"}),
+			wantErr: "latest version v2 must not have outgoing links",
+		},
+		{
+			name:    "cycle",
+			chain:   chain("v3", VersionPair{"v1", "v2"}, VersionPair{"v2", "v1"}, VersionPair{"v2", "v3"}),
+			wantErr: "contains a cycle",
+		},
+		{
+			name:    "downgrade",
+			chain:   chain("v3", VersionPair{"v2", "v1"}, VersionPair{"v1", "v3"}),
+			wantErr: "links must upgrade to a newer version",
+		},
+		{
+			name:    "link past latest version",
+			chain:   chain("v3", VersionPair{"v1", "v4"}),
+			wantErr: "target is newer than latest version v3",
+		},
+		{
+			name:    "unreachable version",
+			chain:   chain("v3", VersionPair{"v1", "v2"}),
+			wantErr: "cannot reach latest version v3",
+		},
+		{
+			name:    "ambiguous paths",
+			chain:   chain("v3", VersionPair{"v1", "v2"}, VersionPair{"v2", "v3"}, VersionPair{"v1", "v3"}),
+			wantErr: "version v1 has ambiguous paths to latest version v3: v1 → v2 → v3; v1 → v3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.chain.Validate()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Validate() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			for from, want := range tt.paths {
+				got, err := tt.chain.findPath(from)
+				if err != nil {
+					t.Fatalf("findPath(%s) error = %v", from, err)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("findPath(%s) = %v, want %v", from, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestTransformUpBeforeValidate(t *testing.T) {
+	c := chain("v2", VersionPair{"v1", "v2"})
+	if _, err := c.TransformUp("players", "bank", "v1", nil); err == nil {
+		t.Fatal("TransformUp() on an unvalidated chain succeeded, want an error")
+	}
+}
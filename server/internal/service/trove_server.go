@@ -5,15 +5,42 @@ import (
 	"errors"
 	"fmt"
 	"github.com/Runic-Studios/Trove/server/internal/db"
-	"log"
-	"runtime/debug"
+	"github.com/Runic-Studios/Trove/server/internal/logging"
+	"github.com/Runic-Studios/Trove/server/internal/metrics"
+	"github.com/Runic-Studios/Trove/server/internal/tracing"
+	"log/slog"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Runic-Studios/Trove/server/gen/api/trove"
 	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
+const (
+	// batchLoadWorkers bounds how many keys of a BatchLoad are queried concurrently
+	batchLoadWorkers = 16
+	// batchLoadMaxKeys bounds how many keys a single BatchLoad can request
+	batchLoadMaxKeys = 1000
+	// watchBuffer is how many events a watcher can fall behind before it is dropped
+	watchBuffer = 256
+)
+
+// LockPolicy bounds the leases game servers can claim, and sets how often expired ones are purged from memory
+type LockPolicy struct {
+	MinLease         time.Duration
+	MaxLease         time.Duration
+	EvictionInterval time.Duration
+}
+
 // lockEntry lives in memory for quick guard checks
 type lockEntry struct {
 	serverID  string
@@ -24,56 +51,123 @@ type lockEntry struct {
 type TroveServer struct {
 	session      *gocql.Session
 	transformers *TransformerChain
-	locks        sync.Map
+	migrator     *Migrator
+	quarantine   *Quarantine
+	fanout       ChangeFanout
+	// publicColumns holds the "table.column"s anyone may read through PublicLoad
+	publicColumns map[string]bool
+	lockPolicy    LockPolicy
+	locks         sync.Map
+	// lastEviction is when evictExpiredLocks last ran, in unix millis
+	lastEviction atomic.Int64
+	// ctx is cancelled by Close to stop background work and end open streams
+	ctx        context.Context
+	cancel     context.CancelFunc
+	patchLocks [patchLockStripes]sync.Mutex
 	trove.UnimplementedTroveServiceServer
 }
 
-// NewTroveServer wires up the Scylla session and a map of chains keyed by "table.column"
+// NewTroveServer wires up the Scylla session, the transformer chain,
+// the policy for rows whose transform fails, the "table.column"s readable without a lock,
+// the fan-out that change events are published through, and the bounds of lock leases
 func NewTroveServer(
 	session *gocql.Session,
 	transformers *TransformerChain,
+	quarantine QuarantinePolicy,
+	publicColumns []string,
+	fanout ChangeFanout,
+	lockPolicy LockPolicy,
 ) *TroveServer {
-	s := &TroveServer{session: session, transformers: transformers}
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &TroveServer{
+		ctx:           ctx,
+		cancel:        cancel,
+		session:       session,
+		transformers:  transformers,
+		quarantine:    NewQuarantine(session, transformers, quarantine),
+		fanout:        fanout,
+		publicColumns: make(map[string]bool, len(publicColumns)),
+		lockPolicy:    lockPolicy,
+	}
+	s.migrator = NewMigrator(session, transformers, s.publishChange)
+	for _, column := range publicColumns {
+		s.publicColumns[strings.TrimSpace(column)] = true
+	}
+	metrics.RegisterActiveLocks(func() float64 {
+		count := 0
+		s.locks.Range(func(_, _ interface{}) bool {
+			count++
+			return true
+		})
+		return float64(count)
+	})
+	s.lastEviction.Store(time.Now().UnixMilli())
 	go s.evictExpiredLocks()
 	return s
 }
 
-// evictExpiredLocks runs every minute to purge stale entries.
+// evictExpiredLocks runs every eviction interval to purge stale entries, until the server is closed.
 func (s *TroveServer) evictExpiredLocks() {
-	ticker := time.NewTicker(time.Minute)
+	ticker := time.NewTicker(s.lockPolicy.EvictionInterval)
 	defer ticker.Stop()
 
-	for now := range ticker.C {
+	for {
+		var now time.Time
+		select {
+		case <-s.ctx.Done():
+			return
+		case now = <-ticker.C:
+		}
+		s.lastEviction.Store(now.UnixMilli())
 		s.locks.Range(func(key, value interface{}) bool {
 			entry := value.(lockEntry)
 			if now.After(entry.expiresAt) {
 				s.locks.Delete(key)
+				metrics.LockOperations.WithLabelValues(metrics.LockExpired).Inc()
 			}
 			return true
 		})
 	}
 }
 
+// Close stops the lock evictor, ends open Watch streams so that they do not hold up a graceful stop,
+// and stops running migrations, which resume from their checkpoints once started again.
+// Locks are leases kept in Scylla, so game servers keep them by claiming again on another server.
+func (s *TroveServer) Close() {
+	s.cancel()
+	s.migrator.StopAll()
+}
+
 // ClaimLock will try to acquire or renew a lease for this player.
 func (s *TroveServer) ClaimLock(
-	_ context.Context,
+	ctx context.Context,
 	req *trove.ClaimLockRequest,
 ) (*trove.ClaimLockResponse, error) {
 	userId := req.GetUserId()
 	sid := req.GetServerId()
 	leaseMillis := req.GetLeaseMillis()
 	if userId == "" || sid == "" || leaseMillis <= 0 {
-		return &trove.ClaimLockResponse{
-			Success:      false,
-			ErrorMessage: "user_id, server_id and lease_millis are required",
-		}, nil
+		msg := "user_id, server_id and lease_millis are required"
+		return &trove.ClaimLockResponse{Success: false, ErrorMessage: msg},
+			invalidArgument(msg, "user_id", "server_id", "lease_millis")
+	}
+	if lease := time.Duration(leaseMillis) * time.Millisecond; lease < s.lockPolicy.MinLease || lease > s.lockPolicy.MaxLease {
+		msg := fmt.Sprintf("lease_millis must be between %d and %d",
+			s.lockPolicy.MinLease.Milliseconds(), s.lockPolicy.MaxLease.Milliseconds())
+		return &trove.ClaimLockResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lease_millis")
 	}
 
 	// Try to acquire or renew
-	acquiredOrRenewed, _, err := db.ClaimLock(s.session, userId, sid, leaseMillis)
+	lwtCtx, span := tracing.Tracer.Start(ctx, "ClaimLock LWT", trace.WithAttributes(attribute.String("trove.user_id", userId)))
+	acquiredOrRenewed, _, err := db.ClaimLock(lwtCtx, s.session, userId, sid, leaseMillis)
+	span.SetAttributes(attribute.Bool("trove.lock.claimed", acquiredOrRenewed))
+	if err != nil {
+		tracing.Fail(span, err)
+	}
+	span.End()
 	if err != nil {
-		log.Printf("internal error claiming lock: %v\n%s", err, debug.Stack())
-		return &trove.ClaimLockResponse{Success: false, ErrorMessage: err.Error()}, nil
+		logError(ctx, "error claiming lock", err)
+		return &trove.ClaimLockResponse{Success: false, ErrorMessage: err.Error()}, errorStatus(err.Error(), err)
 	} else if acquiredOrRenewed {
 		expires := time.Now().Add(time.Duration(leaseMillis) * time.Millisecond)
 		s.locks.Store(userId, lockEntry{serverID: sid, expiresAt: expires})
@@ -84,43 +178,42 @@ func (s *TroveServer) ClaimLock(
 	}
 
 	// failed both acquire and renew -> someone else holds it
-	return &trove.ClaimLockResponse{
-		Success:      false,
-		ErrorMessage: "lock is held by another server",
-	}, nil
+	msg := "lock is held by another server"
+	return &trove.ClaimLockResponse{Success: false, ErrorMessage: msg}, lockConflict(userId, msg)
 }
 
 // ReleaseLock drops the lease if we still own it.
 func (s *TroveServer) ReleaseLock(
-	_ context.Context,
+	ctx context.Context,
 	req *trove.ReleaseLockRequest,
 ) (*trove.ReleaseLockResponse, error) {
 	userId := req.GetUserId()
 	sid := req.GetServerId()
 	if userId == "" || sid == "" {
-		return &trove.ReleaseLockResponse{
-			Success:      false,
-			ErrorMessage: "user_id and server_id are required",
-		}, nil
+		msg := "user_id and server_id are required"
+		return &trove.ReleaseLockResponse{Success: false, ErrorMessage: msg},
+			invalidArgument(msg, "user_id", "server_id")
 	}
 
-	applied, err := db.ReleaseLock(s.session, userId, sid)
+	applied, err := db.ReleaseLock(ctx, s.session, userId, sid)
 	if err != nil {
-		log.Printf("internal error releasing lock: %v\n%s", err, debug.Stack())
-		return &trove.ReleaseLockResponse{Success: false, ErrorMessage: err.Error()}, nil
+		logError(ctx, "error releasing lock", err)
+		return &trove.ReleaseLockResponse{Success: false, ErrorMessage: err.Error()}, errorStatus(err.Error(), err)
 	} else if applied {
 		s.locks.Delete(userId)
 		return &trove.ReleaseLockResponse{Success: true}, nil
 	}
 
-	return &trove.ReleaseLockResponse{
-		Success:      false,
-		ErrorMessage: "cannot release: lock not held by you",
-	}, nil
+	msg := "cannot release: lock not held by you"
+	return &trove.ReleaseLockResponse{Success: false, ErrorMessage: msg}, lockNotHeld(userId, msg)
 }
 
-// validateLock checks our in‑memory map for an unexpired, matching lease
-func (s *TroveServer) validateLock(userID, serverID string) error {
+// validateLock checks our in‑memory map for an unexpired, matching lease, and that the row addressed
+// by superKeys, if any, belongs to the locked player
+func (s *TroveServer) validateLock(userID, serverID string, superKeys map[string]string) error {
+	if owner, ok := superKeys[migratorLockKey]; ok && owner != userID {
+		return errors.New("lock is for a different player")
+	}
 	v, ok := s.locks.Load(userID)
 	if !ok {
 		return errors.New("no lock held for this player")
@@ -131,6 +224,7 @@ func (s *TroveServer) validateLock(userID, serverID string) error {
 	}
 	if time.Now().After(entry.expiresAt) {
 		s.locks.Delete(userID)
+		metrics.LockOperations.WithLabelValues(metrics.LockExpired).Inc()
 		return errors.New("lock has expired")
 	}
 	return nil
@@ -138,19 +232,21 @@ func (s *TroveServer) validateLock(userID, serverID string) error {
 
 // Save writes multiple columns
 func (s *TroveServer) Save(
-	_ context.Context,
+	ctx context.Context,
 	req *trove.SaveRequest,
 ) (*trove.SaveResponse, error) {
 	// enforce lock
 	if req.GetLock() == nil {
-		return &trove.SaveResponse{Success: false, ErrorMessage: "lock info missing"}, nil
+		msg := "lock info missing"
+		return &trove.SaveResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock")
 	}
 	if err := s.validateLock(
 		req.GetLock().GetUserId(),
 		req.GetLock().GetServerId(),
+		req.GetSuperKeys(),
 	); err != nil {
-		log.Printf("internal error saving: %v\n%s", err, debug.Stack())
-		return &trove.SaveResponse{Success: false, ErrorMessage: err.Error()}, nil
+		return &trove.SaveResponse{Success: false, ErrorMessage: err.Error()},
+			lockNotHeld(req.GetLock().GetUserId(), err.Error())
 	}
 
 	table := req.GetTable()
@@ -159,43 +255,359 @@ func (s *TroveServer) Save(
 
 	// validate
 	if table == "" || superKeys == nil || data == nil {
-		return &trove.SaveResponse{
-			Success:      false,
-			ErrorMessage: "missing required fields",
-		}, nil
+		msg := "missing required fields"
+		return &trove.SaveResponse{Success: false, ErrorMessage: msg},
+			invalidArgument(msg, "table", "super_keys", "column_data")
 	}
 
 	// update
 	latest := s.transformers.LatestVersion
 
-	err := db.SaveData(s.session, table, superKeys, data, latest)
+	err := db.SaveData(ctx, s.session, table, superKeys, data, latest)
 	if err != nil {
-		log.Printf("internal error saving: %v\n%s", err, debug.Stack())
-		return &trove.SaveResponse{
-			Success:      false,
-			ErrorMessage: fmt.Sprintf("error saving data: %+v", err),
-		}, nil
+		logError(ctx, "error saving", err)
+		msg := fmt.Sprintf("error saving data: %+v", err)
+		return &trove.SaveResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
 	}
+	s.publishChange("Save", table, superKeys, data, latest)
 
 	return &trove.SaveResponse{Success: true}, nil
 }
 
+// Patch updates only the fields of one column named by update_mask, so that changing a single setting
+// does not mean resending the whole blob. Under the player's lock, the stored blob is brought up to the
+// latest version, decoded with the column's message type, merged with the patch and saved back.
+func (s *TroveServer) Patch(
+	ctx context.Context,
+	req *trove.PatchRequest,
+) (*trove.PatchResponse, error) {
+	// enforce lock
+	if req.GetLock() == nil {
+		msg := "lock info missing"
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock")
+	}
+	if err := s.validateLock(
+		req.GetLock().GetUserId(),
+		req.GetLock().GetServerId(),
+		req.GetSuperKeys(),
+	); err != nil {
+		return &trove.PatchResponse{Success: false, ErrorMessage: err.Error()},
+			lockNotHeld(req.GetLock().GetUserId(), err.Error())
+	}
+
+	table := req.GetTable()
+	superKeys := req.GetSuperKeys()
+	column := req.GetColumn()
+	mask := req.GetUpdateMask()
+
+	// validate
+	if table == "" || superKeys == nil || column == "" || len(mask.GetPaths()) == 0 {
+		msg := "missing required fields"
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg},
+			invalidArgument(msg, "table", "super_keys", "column", "update_mask")
+	}
+	mt, ok := s.transformers.ColumnType(table, column)
+	if !ok {
+		msg := fmt.Sprintf("column %s.%s has no known message type", table, column)
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "column")
+	}
+	typeName := string(mt.Descriptor().FullName())
+	if req.GetMessageType() != typeName {
+		msg := fmt.Sprintf("column %s.%s holds %s, not %s", table, column, typeName, req.GetMessageType())
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "message_type")
+	}
+	patch := mt.New().Interface()
+	if err := proto.Unmarshal(req.GetPatch(), patch); err != nil {
+		msg := fmt.Sprintf("patch is not a valid %s: %v", typeName, err)
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "patch")
+	}
+	if !mask.IsValid(patch) {
+		msg := fmt.Sprintf("update_mask names fields that %s does not have", typeName)
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "update_mask")
+	}
+
+	// read, merge and write back without another patch of this row in between
+	mu := s.patchLock(table, formatKeys(superKeys))
+	mu.Lock()
+	defer mu.Unlock()
+
+	stored, err := s.loadLatest(ctx, table, superKeys, column, mt)
+	if err != nil {
+		logError(ctx, "error patching (load)", err)
+		msg := fmt.Sprintf("error loading data to patch: %+v", err)
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+	if err := mergeMasked(stored.ProtoReflect(), patch.ProtoReflect(), mask.GetPaths()); err != nil {
+		return &trove.PatchResponse{Success: false, ErrorMessage: err.Error()}, invalidArgument(err.Error(), "update_mask")
+	}
+	data, err := proto.Marshal(stored)
+	if err != nil {
+		logError(ctx, "error patching (marshal)", err)
+		msg := fmt.Sprintf("error encoding patched data: %+v", err)
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+
+	latest := s.transformers.LatestVersion
+	err = db.SaveData(ctx, s.session, table, superKeys, map[string][]byte{column: data}, latest)
+	if err != nil {
+		logError(ctx, "error patching (save)", err)
+		msg := fmt.Sprintf("error saving data: %+v", err)
+		return &trove.PatchResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+	s.publishChange("Patch", table, superKeys, map[string][]byte{column: data}, latest)
+
+	return &trove.PatchResponse{
+		Success:    true,
+		ColumnData: data,
+	}, nil
+}
+
+// loadLatest reads one column of a single row decoded as mt, first bringing the whole row up to the
+// latest version if needed, since the row's version covers every one of its columns.
+// A row that does not exist yet decodes as an empty message.
+func (s *TroveServer) loadLatest(
+	ctx context.Context,
+	table string,
+	superKeys map[string]string,
+	column string,
+	mt protoreflect.MessageType,
+) (proto.Message, error) {
+	rows, err := s.loadData(ctx, table, superKeys, []string{column})
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > 1 {
+		return nil, status.Errorf(codes.InvalidArgument, "super_keys match %d rows, expected 1", len(rows))
+	}
+
+	msg := mt.New().Interface()
+	if len(rows) == 0 {
+		return msg, nil
+	}
+	if rows[0].SchemaVersion != s.transformers.LatestVersion {
+		schema, err := db.LoadTableSchema(ctx, s.session, db.Keyspace(), table)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := transformRow(ctx, s.session, s.transformers, table, superKeys, schema.BlobColumns); err != nil {
+			return nil, fmt.Errorf("failed to transform row: %w", err)
+		}
+		if rows, err = s.loadData(ctx, table, superKeys, []string{column}); err != nil {
+			return nil, err
+		}
+		if len(rows) != 1 {
+			return nil, fmt.Errorf("expected 1 row, found %d", len(rows))
+		}
+	}
+
+	if err := proto.Unmarshal(rows[0].Data[column], msg); err != nil {
+		return nil, fmt.Errorf("stored %s.%s is not a valid %s: %w", table, column, mt.Descriptor().FullName(), err)
+	}
+	return msg, nil
+}
+
+// GetMapEntry reads a single map entry inside a column, e.g. one bank page or inventory slot
+func (s *TroveServer) GetMapEntry(
+	ctx context.Context,
+	req *trove.GetMapEntryRequest,
+) (*trove.GetMapEntryResponse, error) {
+	// enforce lock
+	if req.GetLock() == nil {
+		msg := "lock info missing"
+		return &trove.GetMapEntryResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock")
+	}
+	if err := s.validateLock(
+		req.GetLock().GetUserId(),
+		req.GetLock().GetServerId(),
+		req.GetSuperKeys(),
+	); err != nil {
+		return &trove.GetMapEntryResponse{Success: false, ErrorMessage: err.Error()},
+			lockNotHeld(req.GetLock().GetUserId(), err.Error())
+	}
+
+	table := req.GetTable()
+	superKeys := req.GetSuperKeys()
+	path, mt, err := s.mapEntryColumn(table, superKeys, req.GetPath())
+	if err != nil {
+		return &trove.GetMapEntryResponse{Success: false, ErrorMessage: status.Convert(err).Message()}, err
+	}
+
+	stored, err := s.loadLatest(ctx, table, superKeys, path.column, mt)
+	if err != nil {
+		logError(ctx, "error getting map entry", err)
+		msg := fmt.Sprintf("error loading data: %+v", err)
+		return &trove.GetMapEntryResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+	m, key, fd, err := resolveMapEntry(stored.ProtoReflect(), path.steps, false)
+	if err != nil {
+		return &trove.GetMapEntryResponse{Success: false, ErrorMessage: err.Error()}, invalidArgument(err.Error(), "path")
+	}
+	if m == nil || !m.Has(key) {
+		return &trove.GetMapEntryResponse{Success: true, Found: false}, nil
+	}
+
+	data, err := encodeMapValue(fd, m.Get(key))
+	if err != nil {
+		return &trove.GetMapEntryResponse{Success: false, ErrorMessage: err.Error()}, invalidArgument(err.Error(), "path")
+	}
+	return &trove.GetMapEntryResponse{
+		Success: true,
+		Found:   true,
+		Value:   data,
+	}, nil
+}
+
+// PutMapEntry sets a single map entry inside a column, creating the messages leading to it as needed
+func (s *TroveServer) PutMapEntry(
+	ctx context.Context,
+	req *trove.PutMapEntryRequest,
+) (*trove.PutMapEntryResponse, error) {
+	// enforce lock
+	if req.GetLock() == nil {
+		msg := "lock info missing"
+		return &trove.PutMapEntryResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock")
+	}
+	if err := s.validateLock(
+		req.GetLock().GetUserId(),
+		req.GetLock().GetServerId(),
+		req.GetSuperKeys(),
+	); err != nil {
+		return &trove.PutMapEntryResponse{Success: false, ErrorMessage: err.Error()},
+			lockNotHeld(req.GetLock().GetUserId(), err.Error())
+	}
+
+	table := req.GetTable()
+	superKeys := req.GetSuperKeys()
+	path, mt, err := s.mapEntryColumn(table, superKeys, req.GetPath())
+	if err != nil {
+		return &trove.PutMapEntryResponse{Success: false, ErrorMessage: status.Convert(err).Message()}, err
+	}
+
+	_, err = s.editMapEntry(ctx, "PutMapEntry", table, superKeys, path.column, mt, func(root protoreflect.Message) (bool, error) {
+		return true, putMapEntry(root, path.steps, req.GetValue())
+	})
+	if err != nil {
+		logError(ctx, "error putting map entry", err)
+		msg := fmt.Sprintf("error putting map entry: %+v", err)
+		return &trove.PutMapEntryResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+	return &trove.PutMapEntryResponse{Success: true}, nil
+}
+
+// RemoveMapEntry deletes a single map entry inside a column
+func (s *TroveServer) RemoveMapEntry(
+	ctx context.Context,
+	req *trove.RemoveMapEntryRequest,
+) (*trove.RemoveMapEntryResponse, error) {
+	// enforce lock
+	if req.GetLock() == nil {
+		msg := "lock info missing"
+		return &trove.RemoveMapEntryResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock")
+	}
+	if err := s.validateLock(
+		req.GetLock().GetUserId(),
+		req.GetLock().GetServerId(),
+		req.GetSuperKeys(),
+	); err != nil {
+		return &trove.RemoveMapEntryResponse{Success: false, ErrorMessage: err.Error()},
+			lockNotHeld(req.GetLock().GetUserId(), err.Error())
+	}
+
+	table := req.GetTable()
+	superKeys := req.GetSuperKeys()
+	path, mt, err := s.mapEntryColumn(table, superKeys, req.GetPath())
+	if err != nil {
+		return &trove.RemoveMapEntryResponse{Success: false, ErrorMessage: status.Convert(err).Message()}, err
+	}
+
+	removed, err := s.editMapEntry(ctx, "RemoveMapEntry", table, superKeys, path.column, mt, func(root protoreflect.Message) (bool, error) {
+		return removeMapEntry(root, path.steps)
+	})
+	if err != nil {
+		logError(ctx, "error removing map entry", err)
+		msg := fmt.Sprintf("error removing map entry: %+v", err)
+		return &trove.RemoveMapEntryResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+	return &trove.RemoveMapEntryResponse{Success: true, Removed: removed}, nil
+}
+
+// mapEntryColumn validates the fields of a map entry request, returning its parsed path
+// and the message type of the column it points into
+func (s *TroveServer) mapEntryColumn(
+	table string,
+	superKeys map[string]string,
+	rawPath string,
+) (mapEntryPath, protoreflect.MessageType, error) {
+	if table == "" || superKeys == nil || rawPath == "" {
+		return mapEntryPath{}, nil, invalidArgument("missing required fields", "table", "super_keys", "path")
+	}
+	path, err := parseMapEntryPath(rawPath)
+	if err != nil {
+		return mapEntryPath{}, nil, invalidArgument(err.Error(), "path")
+	}
+	mt, ok := s.transformers.ColumnType(table, path.column)
+	if !ok {
+		return mapEntryPath{}, nil, invalidArgument(
+			fmt.Sprintf("column %s.%s has no known message type", table, path.column), "path",
+		)
+	}
+	return path, mt, nil
+}
+
+// editMapEntry applies edit to the decoded column of a single row and saves it back if edit reports a change,
+// without another edit or patch of the row in between
+func (s *TroveServer) editMapEntry(
+	ctx context.Context,
+	operation string,
+	table string,
+	superKeys map[string]string,
+	column string,
+	mt protoreflect.MessageType,
+	edit func(root protoreflect.Message) (bool, error),
+) (bool, error) {
+	mu := s.patchLock(table, formatKeys(superKeys))
+	mu.Lock()
+	defer mu.Unlock()
+
+	stored, err := s.loadLatest(ctx, table, superKeys, column, mt)
+	if err != nil {
+		return false, err
+	}
+	changed, err := edit(stored.ProtoReflect())
+	if err != nil || !changed {
+		return false, err
+	}
+	data, err := proto.Marshal(stored)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode %s.%s: %w", table, column, err)
+	}
+	latest := s.transformers.LatestVersion
+	err = db.SaveData(ctx, s.session, table, superKeys, map[string][]byte{column: data}, latest)
+	if err != nil {
+		return false, err
+	}
+	s.publishChange(operation, table, superKeys, map[string][]byte{column: data}, latest)
+	return true, nil
+}
+
 // Load reads one column, runs TransformUp(table, column, ...),
-// resaves if upgraded, and returns version + blob.
+// resaves if upgraded (unless the request is read only), and returns version + blob.
 func (s *TroveServer) Load(
-	_ context.Context,
+	ctx context.Context,
 	req *trove.LoadRequest,
 ) (*trove.LoadResponse, error) {
 	// enforce lock
 	if req.GetLock() == nil {
-		return &trove.LoadResponse{Success: false, ErrorMessage: "lock info missing"}, nil
+		msg := "lock info missing"
+		return &trove.LoadResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock")
 	}
 	if err := s.validateLock(
 		req.GetLock().GetUserId(),
 		req.GetLock().GetServerId(),
+		req.GetSuperKeys(),
 	); err != nil {
-		log.Printf("internal error loading: %v\n%s", err, debug.Stack())
-		return &trove.LoadResponse{Success: false, ErrorMessage: err.Error()}, nil
+		return &trove.LoadResponse{Success: false, ErrorMessage: err.Error()},
+			lockNotHeld(req.GetLock().GetUserId(), err.Error())
 	}
 
 	table := req.GetTable()
@@ -204,21 +616,38 @@ func (s *TroveServer) Load(
 
 	// validate
 	if table == "" || superKeys == nil || columns == nil {
-		return &trove.LoadResponse{
-			Success:      false,
-			ErrorMessage: "missing required fields",
-		}, nil
+		msg := "missing required fields"
+		return &trove.LoadResponse{Success: false, ErrorMessage: msg},
+			invalidArgument(msg, "table", "super_keys", "columns")
 	}
 
-	rows, err := db.LoadData(s.session, table, superKeys, columns)
+	rows, err := s.loadData(ctx, table, superKeys, columns)
 	if err != nil {
-		log.Printf("internal error loading: %v\n%s", err, debug.Stack())
-		return &trove.LoadResponse{
-			Success:      false,
-			ErrorMessage: fmt.Sprintf("error loading data: %+v", err),
-		}, nil
+		logError(ctx, "error loading", err)
+		msg := fmt.Sprintf("error loading data: %+v", err)
+		return &trove.LoadResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+
+	rowResponse, err := s.transformRows(ctx, table, rows, !req.GetReadOnly(), true)
+	if err != nil {
+		return &trove.LoadResponse{Success: false, ErrorMessage: err.Error()}, errorStatus(err.Error(), err)
 	}
 
+	return &trove.LoadResponse{
+		Success: true,
+		Rows:    rowResponse,
+	}, nil
+}
+
+// transformRows brings loaded rows up to the latest version, and writes upgraded rows back if writeBack is set.
+// Columns whose transform fails get their fallback; with quarantine set, they are also quarantined by the
+// primary key of their row, while read-only callers leave that to the player's own Load.
+func (s *TroveServer) transformRows(
+	ctx context.Context,
+	table string,
+	rows []db.Row,
+	writeBack, quarantine bool,
+) ([]*trove.LoadResponse_Row, error) {
 	rowResponse := make([]*trove.LoadResponse_Row, len(rows))
 
 	for i, row := range rows {
@@ -226,70 +655,312 @@ func (s *TroveServer) Load(
 		data := row.Data
 		// transform if we have a chain for this table.column
 		latest := s.transformers.LatestVersion
+		var quarantined []string
 		if version != latest {
 			up := make(map[string][]byte, len(data))
 			for column, datum := range data {
-				dataUp, err := s.transformers.TransformUp(table, column, version, datum)
+				dataUp, err := s.transformUp(ctx, table, column, version, datum)
 				if err != nil {
-					log.Printf("internal error loading (transform column): %v\n%s", err, debug.Stack())
-					return &trove.LoadResponse{
-						Success:      false,
-						ErrorMessage: fmt.Sprintf("failed to transform column %s: %+v", column, err),
-					}, nil
+					logging.FromContext(ctx).ErrorContext(ctx, "transform failed",
+						slog.String("table", table), slog.String("column", column),
+						slog.String("version", version), slog.Bool("quarantine", quarantine), slog.Any("error", err))
+					var fallback []byte
+					if quarantine {
+						fallback, err = s.quarantine.Add(ctx, table, row.Keys, column, version, datum, err)
+					} else {
+						fallback, err = s.quarantine.Fallback(table, column, datum, err)
+					}
+					if err != nil {
+						return nil, fmt.Errorf("failed to transform column %s: %w", column, err)
+					}
+					up[column] = fallback
+					quarantined = append(quarantined, column)
+					continue
 				}
 				up[column] = dataUp
 			}
-			version = latest
 
-			// trigger a save
-			err := db.SaveData(s.session, table, superKeys, up, version)
-			if err != nil {
-				log.Printf("internal error loading (transform save): %v\n%s", err, debug.Stack())
-				return &trove.LoadResponse{
-					Success:      false,
-					ErrorMessage: fmt.Sprintf("failed to save transformed data: %+v", err),
-				}, nil
+			// trigger a save, unless a column was quarantined and the row has to stay at its old version
+			if len(quarantined) == 0 && writeBack {
+				saveCtx, span := tracing.Tracer.Start(ctx, "Resave", trace.WithAttributes(
+					attribute.String("trove.table", table),
+					attribute.String("trove.version.to", latest),
+				))
+				err := db.SaveData(saveCtx, s.session, table, row.Keys, up, latest)
+				if err != nil {
+					tracing.Fail(span, err)
+				}
+				span.End()
+				if err != nil {
+					logError(ctx, "error saving transformed data", err)
+					return nil, fmt.Errorf("failed to save transformed data: %w", err)
+				}
+				s.publishChange("Load", table, row.Keys, up, latest)
 			}
 			data = up
 		}
 		rowResponse[i] = &trove.LoadResponse_Row{
-			ColumnData: data,
+			ColumnData:         data,
+			QuarantinedColumns: quarantined,
 		}
 	}
 
-	return &trove.LoadResponse{
+	return rowResponse, nil
+}
+
+// PublicLoad reads columns of another player's data without holding their lock.
+// Only columns marked public may be read; data is transformed to the latest version on read
+// but never written back, so it touches neither the owner's lease nor their row. Columns that fail
+// to transform get their fallback, but are not quarantined nor alerted on.
+func (s *TroveServer) PublicLoad(
+	ctx context.Context,
+	req *trove.PublicLoadRequest,
+) (*trove.PublicLoadResponse, error) {
+	table := req.GetTable()
+	superKeys := req.GetSuperKeys()
+	columns := req.GetColumns()
+
+	// validate
+	if table == "" || superKeys == nil || columns == nil {
+		msg := "missing required fields"
+		return &trove.PublicLoadResponse{Success: false, ErrorMessage: msg},
+			invalidArgument(msg, "table", "super_keys", "columns")
+	}
+	for _, column := range columns {
+		if !s.publicColumns[table+"."+column] {
+			msg := fmt.Sprintf("column %s.%s is not public", table, column)
+			return &trove.PublicLoadResponse{Success: false, ErrorMessage: msg},
+				statusError(codes.PermissionDenied, msg)
+		}
+	}
+
+	rows, err := s.loadData(ctx, table, superKeys, columns)
+	if err != nil {
+		logError(ctx, "error loading public data", err)
+		msg := fmt.Sprintf("error loading data: %+v", err)
+		return &trove.PublicLoadResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+
+	rowResponse, err := s.transformRows(ctx, table, rows, false, false)
+	if err != nil {
+		return &trove.PublicLoadResponse{Success: false, ErrorMessage: err.Error()}, errorStatus(err.Error(), err)
+	}
+
+	return &trove.PublicLoadResponse{
 		Success: true,
 		Rows:    rowResponse,
 	}, nil
 }
 
+// BatchLoad reads the same columns for many keys of a table in one call, for screens like leaderboards
+// and guild rosters. Keys are loaded concurrently and fail independently of each other.
+// A key needs a matching lock unless every column is public, and only locked keys are written back.
+// Columns that fail to transform get their fallback without being quarantined, so a batch over many
+// keys never writes quarantine rows or fires alerts.
+func (s *TroveServer) BatchLoad(
+	ctx context.Context,
+	req *trove.BatchLoadRequest,
+) (*trove.BatchLoadResponse, error) {
+	table := req.GetTable()
+	columns := req.GetColumns()
+	keys := req.GetKeys()
+
+	// validate
+	if table == "" || columns == nil || keys == nil {
+		msg := "missing required fields"
+		return &trove.BatchLoadResponse{Success: false, ErrorMessage: msg},
+			invalidArgument(msg, "table", "columns", "keys")
+	}
+	if len(keys) > batchLoadMaxKeys {
+		msg := fmt.Sprintf("at most %d keys can be loaded at once", batchLoadMaxKeys)
+		return &trove.BatchLoadResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "keys")
+	}
+	public := true
+	for _, column := range columns {
+		if !s.publicColumns[table+"."+column] {
+			public = false
+			break
+		}
+	}
+
+	// fan out over a bounded pool of workers
+	results := make([]*trove.BatchLoadResponse_Result, len(keys))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for range min(batchLoadWorkers, len(keys)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				results[i] = s.batchLoadKey(ctx, table, columns, keys[i], public, !req.GetReadOnly())
+			}
+		}()
+	}
+	for i := range keys {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+
+	return &trove.BatchLoadResponse{
+		Success: true,
+		Results: results,
+	}, nil
+}
+
+// batchLoadKey loads and transforms a single key of a BatchLoad, reporting any failure in its result
+func (s *TroveServer) batchLoadKey(
+	ctx context.Context,
+	table string,
+	columns []string,
+	key *trove.BatchLoadRequest_Key,
+	public bool,
+	writeBack bool,
+) *trove.BatchLoadResponse_Result {
+	superKeys := key.GetSuperKeys()
+	if superKeys == nil {
+		return batchLoadFailure(invalidArgument("super_keys are required", "super_keys"))
+	}
+
+	// enforce lock, unless the key is only read
+	lock := key.GetLock()
+	if lock == nil && !public {
+		return batchLoadFailure(invalidArgument("lock info missing", "lock"))
+	}
+	if lock != nil {
+		userId := lock.GetUserId()
+		if err := s.validateLock(userId, lock.GetServerId(), superKeys); err != nil {
+			return batchLoadFailure(lockNotHeld(userId, err.Error()))
+		}
+	}
+
+	rows, err := s.loadData(ctx, table, superKeys, columns)
+	if err != nil {
+		logError(ctx, "error batch loading", err)
+		return batchLoadFailure(errorStatus(fmt.Sprintf("error loading data: %+v", err), err))
+	}
+
+	rowResponse, err := s.transformRows(ctx, table, rows, lock != nil && writeBack, false)
+	if err != nil {
+		return batchLoadFailure(errorStatus(err.Error(), err))
+	}
+	return &trove.BatchLoadResponse_Result{
+		Success: true,
+		Rows:    rowResponse,
+	}
+}
+
+// batchLoadFailure reports a failed key of a BatchLoad with its status code
+func batchLoadFailure(err error) *trove.BatchLoadResponse_Result {
+	st := status.Convert(err)
+	return &trove.BatchLoadResponse_Result{
+		Success:      false,
+		ErrorMessage: st.Message(),
+		ErrorCode:    int32(st.Code()),
+	}
+}
+
+// Watch streams an event for every write to the watched rows and columns, so that game servers caching
+// a player's data hear about changes made elsewhere, e.g. by an admin.
+// A watcher that falls too far behind is ended with RESOURCE_EXHAUSTED and should reload before watching again.
+func (s *TroveServer) Watch(
+	req *trove.WatchRequest,
+	stream grpc.ServerStreamingServer[trove.WatchEvent],
+) error {
+	table := req.GetTable()
+	if table == "" {
+		return invalidArgument("table is required", "table")
+	}
+	watched := make(map[string]bool, len(req.GetColumns()))
+	for _, column := range req.GetColumns() {
+		watched[column] = true
+	}
+	// only callers trusted with every column get their blobs, everyone else only gets public ones
+	allData := true
+	if p, ok := PrincipalFromContext(stream.Context()); ok {
+		allData = p.Role == RoleAdmin || p.Role == RoleGameServer
+	}
+
+	events, unsubscribe := s.fanout.Subscribe(watchBuffer)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return status.FromContextError(stream.Context().Err()).Err()
+		case <-s.ctx.Done():
+			return statusError(codes.Unavailable, "server is shutting down, watch again")
+		case event, ok := <-events:
+			if !ok {
+				return statusError(codes.ResourceExhausted, "watcher fell behind, reload and watch again")
+			}
+			if event.Table != table || !matchesWatch(event.SuperKeys, req.GetSuperKeysPrefix()) {
+				continue
+			}
+
+			var columns []string
+			var data map[string][]byte
+			if req.GetIncludeData() {
+				data = make(map[string][]byte, len(event.Columns))
+			}
+			for column, datum := range event.Columns {
+				if len(watched) > 0 && !watched[column] {
+					continue
+				}
+				columns = append(columns, column)
+				if data != nil && (allData || s.publicColumns[table+"."+column]) {
+					data[column] = datum
+				}
+			}
+			if len(columns) == 0 {
+				continue
+			}
+
+			err := stream.Send(&trove.WatchEvent{
+				Table:               event.Table,
+				SuperKeys:           event.SuperKeys,
+				Operation:           event.Operation,
+				Columns:             columns,
+				ColumnData:          data,
+				SchemaVersion:       event.SchemaVersion,
+				Sequence:            event.Sequence,
+				ChangedAtUnixMillis: event.ChangedAt.UnixMilli(),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
 // Exists checks if a row exists in a given table that contains the requested super keys
 // Used when a user first logs in to check if they have data already, or if we need to populate it
 func (s *TroveServer) Exists(
-	_ context.Context,
+	ctx context.Context,
 	req *trove.ExistsRequest,
 ) (*trove.ExistsResponse, error) {
 	// enforce lock
 	if req.GetLock() == nil {
-		return &trove.ExistsResponse{Success: false, ErrorMessage: "lock info missing"}, nil
+		msg := "lock info missing"
+		return &trove.ExistsResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock")
 	}
 	if err := s.validateLock(
 		req.GetLock().GetUserId(),
 		req.GetLock().GetServerId(),
+		req.GetSuperKeys(),
 	); err != nil {
-		return &trove.ExistsResponse{Success: false, ErrorMessage: err.Error()}, nil
+		return &trove.ExistsResponse{Success: false, ErrorMessage: err.Error()},
+			lockNotHeld(req.GetLock().GetUserId(), err.Error())
 	}
 
 	table := req.GetTable()
 	superKeys := req.GetSuperKeys()
 
-	exists, err := db.Exists(s.session, table, superKeys)
+	exists, err := db.Exists(ctx, s.session, table, superKeys)
 	if err != nil {
-		log.Printf("internal error check exists: %v\n%s", err, debug.Stack())
-		return &trove.ExistsResponse{
-			Success:      false,
-			ErrorMessage: fmt.Sprintf("failed to check if row exists: %+v", err),
-		}, nil
+		logError(ctx, "error checking existence", err)
+		msg := fmt.Sprintf("failed to check if row exists: %+v", err)
+		return &trove.ExistsResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
 	}
 
 	return &trove.ExistsResponse{
@@ -297,3 +968,290 @@ func (s *TroveServer) Exists(
 		Exists:  exists,
 	}, nil
 }
+
+// SendMail appends a delivery to a player's mailbox, whether they are offline or online on any server.
+// It needs no lock, since it never touches the player's own rows; the owning server claims the mail
+// through ClaimMail, and can hear about it sooner by watching the mailbox table
+func (s *TroveServer) SendMail(
+	ctx context.Context,
+	req *trove.SendMailRequest,
+) (*trove.SendMailResponse, error) {
+	userId := req.GetUserId()
+	if userId == "" || req.GetPayload() == nil {
+		msg := "user_id and payload are required"
+		return &trove.SendMailResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "user_id", "payload")
+	}
+	if _, err := gocql.ParseUUID(userId); err != nil {
+		msg := "user_id must be a UUID"
+		return &trove.SendMailResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "user_id")
+	}
+
+	mail, err := db.SendMail(ctx, s.session, userId, req.GetSender(), req.GetPayload())
+	if err != nil {
+		logError(ctx, "error sending mail", err)
+		msg := fmt.Sprintf("failed to send mail: %+v", err)
+		return &trove.SendMailResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+	s.publishChange("SendMail", db.MailboxTable, map[string]string{migratorLockKey: userId},
+		map[string][]byte{"payload": mail.Payload}, "")
+
+	return &trove.SendMailResponse{
+		Success: true,
+		MailId:  mail.MailID.String(),
+	}, nil
+}
+
+// ClaimMail returns the undelivered mail of the locked player and marks it as delivered to the lock holder.
+// Every delivery is returned by exactly one claim, even if two claims race
+func (s *TroveServer) ClaimMail(
+	ctx context.Context,
+	req *trove.ClaimMailRequest,
+) (*trove.ClaimMailResponse, error) {
+	// enforce lock
+	if req.GetLock() == nil {
+		msg := "lock info missing"
+		return &trove.ClaimMailResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock")
+	}
+	userId := req.GetLock().GetUserId()
+	sid := req.GetLock().GetServerId()
+	if _, err := gocql.ParseUUID(userId); err != nil {
+		msg := "lock user_id must be a UUID"
+		return &trove.ClaimMailResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "lock.user_id")
+	}
+	if err := s.validateLock(userId, sid, nil); err != nil {
+		return &trove.ClaimMailResponse{Success: false, ErrorMessage: err.Error()}, lockNotHeld(userId, err.Error())
+	}
+
+	pending, err := db.ListUndeliveredMail(ctx, s.session, userId, int(req.GetLimit()))
+	if err != nil {
+		logError(ctx, "error listing mail", err)
+		msg := fmt.Sprintf("failed to list mail: %+v", err)
+		return &trove.ClaimMailResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+
+	claimed := make([]*trove.Mail, 0, len(pending))
+	for _, mail := range pending {
+		applied, err := db.MarkMailDelivered(ctx, s.session, userId, mail.MailID, sid)
+		if err != nil {
+			// mail marked so far is returned rather than lost; the rest stays undelivered for the next claim
+			logError(ctx, "error claiming mail", err)
+			if len(claimed) > 0 {
+				break
+			}
+			msg := fmt.Sprintf("failed to claim mail: %+v", err)
+			return &trove.ClaimMailResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+		}
+		if !applied {
+			continue
+		}
+		claimed = append(claimed, &trove.Mail{
+			MailId:           mail.MailID.String(),
+			Sender:           mail.Sender,
+			Payload:          mail.Payload,
+			SentAtUnixMillis: mail.SentAt.UnixMilli(),
+		})
+	}
+
+	return &trove.ClaimMailResponse{
+		Success: true,
+		Mail:    claimed,
+	}, nil
+}
+
+// StartMigration starts or resumes a background migration of every row in a table to the latest schema version
+func (s *TroveServer) StartMigration(
+	ctx context.Context,
+	req *trove.StartMigrationRequest,
+) (*trove.StartMigrationResponse, error) {
+	table := req.GetTable()
+	if table == "" {
+		msg := "table is required"
+		return &trove.StartMigrationResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "table")
+	}
+
+	err := s.migrator.Start(ctx, table, int(req.GetRowsPerSecond()), req.GetRestart())
+	if err != nil {
+		logError(ctx, "error starting migration", err)
+		return &trove.StartMigrationResponse{Success: false, ErrorMessage: err.Error()}, errorStatus(err.Error(), err)
+	}
+	return &trove.StartMigrationResponse{Success: true}, nil
+}
+
+// StopMigration cancels a running migration, which can later be resumed from its checkpoint
+func (s *TroveServer) StopMigration(
+	ctx context.Context,
+	req *trove.StopMigrationRequest,
+) (*trove.StopMigrationResponse, error) {
+	table := req.GetTable()
+	if table == "" {
+		msg := "table is required"
+		return &trove.StopMigrationResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "table")
+	}
+
+	if err := s.migrator.Stop(ctx, table); err != nil {
+		return &trove.StopMigrationResponse{Success: false, ErrorMessage: err.Error()}, errorStatus(err.Error(), err)
+	}
+	return &trove.StopMigrationResponse{Success: true}, nil
+}
+
+// MigrationStatus reports the checkpointed progress of a migration,
+// and optionally how many rows remain at each outdated schema version
+func (s *TroveServer) MigrationStatus(
+	ctx context.Context,
+	req *trove.MigrationStatusRequest,
+) (*trove.MigrationStatusResponse, error) {
+	table := req.GetTable()
+	if table == "" {
+		msg := "table is required"
+		return &trove.MigrationStatusResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "table")
+	}
+
+	status, err := s.migrator.Status(ctx, table)
+	if err != nil {
+		logError(ctx, "error loading migration status", err)
+		msg := fmt.Sprintf("failed to load migration status: %+v", err)
+		return &trove.MigrationStatusResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+
+	var remaining map[string]int64
+	if req.GetCountRemaining() {
+		remaining, err = s.migrator.RemainingByVersion(ctx, table)
+		if err != nil {
+			logError(ctx, "error counting remaining rows", err)
+			msg := fmt.Sprintf("failed to count remaining rows: %+v", err)
+			return &trove.MigrationStatusResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+		}
+	}
+
+	cp := status.Checkpoint
+	return &trove.MigrationStatusResponse{
+		Success:            true,
+		Running:            status.Running,
+		TargetVersion:      cp.TargetVersion,
+		CompletedRanges:    int32(cp.NextRange),
+		TotalRanges:        int32(cp.TotalRanges),
+		Migrated:           cp.Migrated,
+		Skipped:            cp.Skipped,
+		Failed:             cp.Failed,
+		RemainingByVersion: remaining,
+		LastError:          status.LastError,
+	}, nil
+}
+
+// DryRunMigration starts running the transformer chain over a table in the background without writing anything,
+// or reports on the dry run already started, with failures grouped by error, blob size deltas and round-trip mismatches
+func (s *TroveServer) DryRunMigration(
+	ctx context.Context,
+	req *trove.DryRunMigrationRequest,
+) (*trove.DryRunMigrationResponse, error) {
+	table := req.GetTable()
+	if table == "" {
+		msg := "table is required"
+		return &trove.DryRunMigrationResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "table")
+	}
+
+	status, err := s.migrator.DryRun(ctx, table, DryRunOptions{
+		SampleRanges: int(req.GetSampleRanges()),
+		MaxRows:      req.GetMaxRows(),
+		MaxExamples:  int(req.GetMaxExamples()),
+	}, req.GetRestart())
+	if err != nil {
+		logError(ctx, "error running migration dry run", err)
+		msg := fmt.Sprintf("failed to run dry run: %+v", err)
+		return &trove.DryRunMigrationResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+
+	report := status.Report
+	failures := make([]*trove.DryRunMigrationResponse_Failure, len(report.Failures))
+	for i, f := range report.Failures {
+		failures[i] = &trove.DryRunMigrationResponse_Failure{
+			Error:       f.Error,
+			Count:       f.Count,
+			ExampleKeys: f.ExampleKeys,
+		}
+	}
+	columns := make([]*trove.DryRunMigrationResponse_Column, len(report.Columns))
+	for i, c := range report.Columns {
+		columns[i] = &trove.DryRunMigrationResponse_Column{
+			Column:           c.Column,
+			Transformed:      c.Transformed,
+			BytesBefore:      c.BytesBefore,
+			BytesAfter:       c.BytesAfter,
+			DecodeMismatches: c.DecodeMismatches,
+		}
+	}
+
+	return &trove.DryRunMigrationResponse{
+		Success:         true,
+		TargetVersion:   report.TargetVersion,
+		RowsScanned:     report.RowsScanned,
+		RowsOutdated:    report.RowsOutdated,
+		RowsTransformed: report.RowsTransformed,
+		RowsFailed:      report.RowsFailed,
+		Failures:        failures,
+		Columns:         columns,
+		Running:         status.Running,
+		CompletedRanges: int32(status.CompletedRanges),
+		TotalRanges:     int32(status.TotalRanges),
+		LastError:       status.LastError,
+	}, nil
+}
+
+// ListQuarantined lists columns whose transform failed during Load, along with their original blobs
+func (s *TroveServer) ListQuarantined(
+	ctx context.Context,
+	req *trove.ListQuarantinedRequest,
+) (*trove.ListQuarantinedResponse, error) {
+	table := req.GetTable()
+	if table == "" {
+		msg := "table is required"
+		return &trove.ListQuarantinedResponse{Success: false, ErrorMessage: msg}, invalidArgument(msg, "table")
+	}
+
+	entries, err := s.quarantine.List(ctx, table, int(req.GetLimit()))
+	if err != nil {
+		logError(ctx, "error listing quarantined rows", err)
+		msg := fmt.Sprintf("failed to list quarantined rows: %+v", err)
+		return &trove.ListQuarantinedResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+
+	rows := make([]*trove.QuarantinedRow, len(entries))
+	for i, entry := range entries {
+		rows[i] = &trove.QuarantinedRow{
+			Table:                   entry.Table,
+			RowKey:                  entry.RowKey,
+			Column:                  entry.Column,
+			SuperKeys:               entry.SuperKeys,
+			SchemaVersion:           entry.SchemaVersion,
+			VersionPath:             entry.VersionPath,
+			Error:                   entry.Error,
+			QuarantinedAtUnixMillis: entry.QuarantinedAt.UnixMilli(),
+		}
+		if req.GetIncludeOriginal() {
+			rows[i].Original = entry.Original
+		}
+	}
+	return &trove.ListQuarantinedResponse{Success: true, Rows: rows}, nil
+}
+
+// RetryQuarantined re-runs the transformer chain over a quarantined row, releasing it from quarantine on success
+func (s *TroveServer) RetryQuarantined(
+	ctx context.Context,
+	req *trove.RetryQuarantinedRequest,
+) (*trove.RetryQuarantinedResponse, error) {
+	table := req.GetTable()
+	rowKey := req.GetRowKey()
+	if table == "" || rowKey == "" {
+		msg := "table and row_key are required"
+		return &trove.RetryQuarantinedResponse{Success: false, ErrorMessage: msg},
+			invalidArgument(msg, "table", "row_key")
+	}
+
+	retried, err := s.quarantine.Retry(ctx, table, rowKey)
+	if err != nil {
+		logError(ctx, "error retrying quarantined row", err)
+		msg := fmt.Sprintf("failed to retry quarantined row: %+v", err)
+		return &trove.RetryQuarantinedResponse{Success: false, ErrorMessage: msg}, errorStatus(msg, err)
+	}
+	return &trove.RetryQuarantinedResponse{Success: true, Retried: int32(retried)}, nil
+}
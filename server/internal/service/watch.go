@@ -0,0 +1,102 @@
+package service
+
+import (
+	"maps"
+	"sync"
+	"time"
+)
+
+// ChangeEvent describes a write to some columns of a single row.
+type ChangeEvent struct {
+	Table         string
+	SuperKeys     map[string]string
+	Operation     string
+	Columns       map[string][]byte
+	SchemaVersion string
+	// Sequence is assigned by the fan-out when the event is published
+	Sequence  int64
+	ChangedAt time.Time
+}
+
+// ChangeFanout delivers change events to every watcher, which may be connected to another replica.
+type ChangeFanout interface {
+	// Publish hands an event to every subscriber without blocking the write that produced it.
+	Publish(event ChangeEvent)
+	// Subscribe returns a channel of every event published from now on, and a function to unsubscribe.
+	// A subscriber that falls more than buffer events behind has its channel closed.
+	Subscribe(buffer int) (<-chan ChangeEvent, func())
+}
+
+// LocalFanout is a ChangeFanout that only reaches watchers connected to this server.
+type LocalFanout struct {
+	mu       sync.Mutex
+	sequence int64
+	subs     map[chan ChangeEvent]struct{}
+}
+
+// NewLocalFanout creates an in-process fan-out with no subscribers.
+func NewLocalFanout() *LocalFanout {
+	return &LocalFanout{subs: make(map[chan ChangeEvent]struct{})}
+}
+
+// Publish implements ChangeFanout.
+func (f *LocalFanout) Publish(event ChangeEvent) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sequence++
+	event.Sequence = f.sequence
+	for ch := range f.subs {
+		select {
+		case ch <- event:
+		default:
+			// too far behind to keep up, the watcher has to reload and watch again
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe implements ChangeFanout.
+func (f *LocalFanout) Subscribe(buffer int) (<-chan ChangeEvent, func()) {
+	ch := make(chan ChangeEvent, buffer)
+	f.mu.Lock()
+	f.subs[ch] = struct{}{}
+	f.mu.Unlock()
+
+	return ch, func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if _, ok := f.subs[ch]; ok {
+			delete(f.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// publishChange reports a successful write of data to the row at superKeys.
+func (s *TroveServer) publishChange(
+	operation, table string,
+	superKeys map[string]string,
+	data map[string][]byte,
+	version string,
+) {
+	s.fanout.Publish(ChangeEvent{
+		Table:         table,
+		SuperKeys:     maps.Clone(superKeys),
+		Operation:     operation,
+		Columns:       data,
+		SchemaVersion: version,
+		ChangedAt:     time.Now(),
+	})
+}
+
+// matchesWatch reports whether a row's keys include every key of prefix.
+func matchesWatch(superKeys, prefix map[string]string) bool {
+	for k, v := range prefix {
+		if superKeys[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+// Package tracing sets up OpenTelemetry tracing of the trove-server.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/Runic-Studios/Trove/server/internal/config"
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracer creates every span of the trove-server
+var Tracer = otel.Tracer("github.com/Runic-Studios/Trove/server")
+
+// Setup installs the global tracer provider and W3C trace context propagation, exporting spans as chosen
+// by the config: "otlp" sends them to a collector configured through the standard
+// OTEL_EXPORTER_OTLP_* env vars, "stdout" prints them, and no exporter disables tracing.
+// Sampling follows the standard OTEL_TRACES_SAMPLER env vars.
+// The returned function flushes buffered spans and stops exporting.
+func Setup(ctx context.Context, cfg config.Tracing) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "otlp":
+		exporter, err = otlptracegrpc.New(ctx)
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "":
+		slog.Info("no trace exporter configured, tracing disabled")
+		return func(context.Context) error { return nil }, nil
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName("trove-server")))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// QueryObserver records every CQL query attempt as a span under the span of the query's context,
+// then hands the query to Next, if set.
+type QueryObserver struct {
+	Next gocql.QueryObserver
+}
+
+// ObserveQuery implements gocql.QueryObserver.
+func (o QueryObserver) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	if trace.SpanFromContext(ctx).SpanContext().IsValid() {
+		_, span := Tracer.Start(ctx, "cql",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithTimestamp(q.Start),
+			trace.WithAttributes(
+				semconv.DBSystemCassandra,
+				semconv.DBQueryText(q.Statement),
+				semconv.DBNamespace(q.Keyspace),
+				attribute.Int("db.cassandra.attempt", q.Attempt),
+				attribute.Int("db.cassandra.rows", q.Rows),
+			),
+		)
+		if q.Host != nil {
+			span.SetAttributes(
+				semconv.ServerAddress(q.Host.ConnectAddress().String()),
+				semconv.ServerPort(q.Host.Port()),
+			)
+		}
+		if q.Err != nil {
+			span.RecordError(q.Err)
+			span.SetStatus(codes.Error, q.Err.Error())
+		}
+		span.End(trace.WithTimestamp(q.End))
+	}
+	if o.Next != nil {
+		o.Next.ObserveQuery(ctx, q)
+	}
+}
+
+// Fail records err on span and marks it as failed.
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// VersionAttributes describes a hop through the transformer chain.
+func VersionAttributes(from, to string, hops int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("trove.version.from", from),
+		attribute.String("trove.version.to", to),
+		attribute.Int("trove.version.hops", hops),
+	}
+}
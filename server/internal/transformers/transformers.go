@@ -1,7 +1,10 @@
 package transformers
 
 import (
+	characterv1 "github.com/Runic-Studios/Trove/server/gen/api/schema/v1/character"
+	playersv1 "github.com/Runic-Studios/Trove/server/gen/api/schema/v1/player"
 	"github.com/Runic-Studios/Trove/server/internal/service"
+	"google.golang.org/protobuf/reflect/protoreflect"
 )
 
 // V1Transformer transformer specifically for transforming data in the players database
@@ -9,4 +12,20 @@ var V1Transformer = &service.TransformerChain{
 	LatestVersion: "v1",
 	// Example transformer
 	Links: map[service.VersionPair]service.TransformerFunc{},
+	// Message types of each column at the latest version
+	ColumnTypes: map[string]protoreflect.MessageType{
+		"players.achievements": (&playersv1.PlayerAchievementsData{}).ProtoReflect().Type(),
+		"players.bank":         (&playersv1.PlayerBankData{}).ProtoReflect().Type(),
+		"players.gathering":    (&playersv1.PlayerGatheringData{}).ProtoReflect().Type(),
+		"players.mounts":       (&playersv1.PlayerMountsData{}).ProtoReflect().Type(),
+		"players.settings":     (&playersv1.PlayerSettingsData{}).ProtoReflect().Type(),
+		"players.traits":       (&playersv1.PlayerTraitsData{}).ProtoReflect().Type(),
+
+		"characters.inventory":  (&characterv1.CharacterInventoryData{}).ProtoReflect().Type(),
+		"characters.profession": (&characterv1.CharacterProfessionData{}).ProtoReflect().Type(),
+		"characters.quests":     (&characterv1.CharacterQuestsData{}).ProtoReflect().Type(),
+		"characters.skills":     (&characterv1.CharacterSkillsData{}).ProtoReflect().Type(),
+		"characters.spells":     (&characterv1.CharacterSpellsData{}).ProtoReflect().Type(),
+		"characters.traits":     (&characterv1.CharacterTraitsData{}).ProtoReflect().Type(),
+	},
 }